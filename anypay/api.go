@@ -0,0 +1,181 @@
+package anypay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+const APIURL = "https://anypay.io/api/"
+
+type (
+	// Transaction is a payment returned by the API.
+	Transaction struct {
+		TransactionID json.Number `json:"transaction_id"`
+		PayID         string      `json:"pay_id"`
+		Status        string      `json:"status"`
+		Method        string      `json:"method"`
+		Amount        json.Number `json:"amount"`
+		Currency      string      `json:"currency"`
+		Profit        json.Number `json:"profit"`
+		Email         string      `json:"email"`
+		Desc          string      `json:"desc"`
+		Date          string      `json:"date"`
+		PayDate       string      `json:"pay_date"`
+	}
+)
+
+// Payment implements checkout.Fetcher. Requires APIID and APIToken.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	var result struct {
+		Payments map[string]Transaction `json:"payments"`
+	}
+
+	params := url.Values{}
+	params.Set("project_id", c.MerchantID)
+	params.Set("pay_id", id)
+
+	if err := c.api(ctx, "payments", params, &result); err != nil {
+		return checkout.Payment{}, err
+	}
+
+	for _, t := range result.Payments {
+		if t.PayID == id {
+			return t.payment()
+		}
+	}
+
+	return checkout.Payment{}, checkout.ErrPaymentNotFound
+}
+
+// Payments implements checkout.Lister. Requires APIID and APIToken.
+// The API has no date filter, so the whole history is fetched.
+func (c Checkout) Payments(ctx context.Context, from, to time.Time) ([]checkout.Payment, error) {
+	var payments []checkout.Payment
+	for offset := 0; ; {
+		var result struct {
+			Total    int                    `json:"total"`
+			Payments map[string]Transaction `json:"payments"`
+		}
+
+		params := url.Values{}
+		params.Set("project_id", c.MerchantID)
+		params.Set("offset", strconv.Itoa(offset))
+
+		if err := c.api(ctx, "payments", params, &result); err != nil {
+			return nil, err
+		}
+
+		for _, t := range result.Payments {
+			created, err := time.ParseInLocation(timeLayout, t.Date, timeLoc)
+			if err != nil || created.Before(from) || !created.Before(to) {
+				continue
+			}
+
+			payment, err := t.payment()
+			if err != nil {
+				return nil, err
+			}
+			payments = append(payments, payment)
+		}
+
+		offset += len(result.Payments)
+		if len(result.Payments) == 0 || offset >= result.Total {
+			break
+		}
+	}
+
+	sort.Slice(payments, func(i, k int) bool {
+		return payments[i].ID < payments[k].ID
+	})
+	return payments, nil
+}
+
+func (t Transaction) payment() (checkout.Payment, error) {
+	amount, err := checkout.ParseMoney(t.Amount.String(), t.Currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	profit, err := checkout.ParseMoney(t.Profit.String(), t.Currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	paidAt, _ := time.ParseInLocation(timeLayout, t.PayDate, timeLoc)
+
+	return checkout.Payment{
+		Checkout: "anypay",
+		ID:       t.PayID,
+		Amount:   amount,
+		Comment:  t.Desc,
+		Status:   statuses[t.Status],
+		Profit:   profit,
+		PaidAt:   paidAt.UTC(),
+		V:        t,
+	}, nil
+}
+
+func (c Checkout) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// api calls the API method, decoding the result into v.
+func (c Checkout) api(ctx context.Context, method string, params url.Values, v any) error {
+	hash := sha256.Sum256([]byte(method + c.APIID + params.Get("project_id") + c.APIToken))
+	params.Set("sign", hex.EncodeToString(hash[:]))
+
+	base := c.APIURL
+	if base == "" {
+		base = APIURL
+	}
+	end := base + method + "/" + url.PathEscape(c.APIID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, end, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if result.Error != nil {
+		return &checkout.ProviderError{
+			Checkout:   "anypay",
+			StatusCode: resp.StatusCode,
+			Code:       strconv.Itoa(result.Error.Code),
+			Message:    result.Error.Message,
+		}
+	}
+
+	return json.Unmarshal(result.Result, v)
+}
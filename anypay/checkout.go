@@ -1,11 +1,12 @@
 package anypay
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 	"time"
@@ -19,22 +20,62 @@ const BaseURL = "https://anypay.io/merchant?"
 type Checkout struct {
 	MerchantID string
 	APIKey     string
+	Logger     checkout.Logger
+
+	// APIID and APIToken are credentials of the account API,
+	// needed to query the API.
+	APIID    string
+	APIToken string
+
+	// Client and APIURL default to http.DefaultClient and APIURL.
+	Client *http.Client
+	APIURL string
+}
+
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout: "anypay",
+		Metadata: true,
+		Profit:   true,
+		Currencies: []string{
+			checkout.RUB, checkout.UAH, checkout.USD, checkout.EUR, checkout.KZT, checkout.BYN,
+			checkout.BTC, checkout.ETH, checkout.LTC, checkout.USDT, checkout.TRX,
+		},
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
 }
 
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(_ context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
 	params := url.Values{}
 	params.Set("merchant_id", c.MerchantID)
 	params.Set("pay_id", payment.ID)
-	params.Set("amount", payment.Amount)
-	params.Set("currency", payment.Currency)
+
+	amount := payment.Amount.Format()
+	params.Set("amount", amount)
+	params.Set("currency", payment.Amount.Currency)
 
 	for k, v := range payment.Metadata {
 		params.Set(k, fmt.Sprint(v))
 	}
 
 	a := strings.Join([]string{
-		payment.Currency,
-		payment.Amount,
+		payment.Amount.Currency,
+		amount,
 		c.APIKey,
 		c.MerchantID,
 		payment.ID,
@@ -50,56 +91,112 @@ var (
 	timeLoc, _ = time.LoadLocation("Europe/Moscow")
 )
 
+var statuses = map[string]checkout.Status{
+	"paid":     checkout.StatusPaid,
+	"waiting":  checkout.StatusWaiting,
+	"refund":   checkout.StatusRefunded,
+	"canceled": checkout.StatusCanceled,
+	"expired":  checkout.StatusExpired,
+	"error":    checkout.StatusRejected,
+}
+
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
+
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			log.Println("checkout/anypay:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		payment, err := c.Parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, "anypay", err)
 			return
 		}
 
-		paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("pay_date"), timeLoc)
-		if err != nil {
-			log.Println("checkout/anypay:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "anypay", err)
 			return
 		}
 
-		payment := checkout.Payment{
-			Checkout: "anypay",
-			ID:       r.FormValue("pay_id"),
-			Amount:   r.FormValue("amount"),
-			Currency: r.FormValue("currency"),
-			Metadata: make(checkout.Metadata),
-			Status:   checkout.StatusPaid,
-			Profit:   r.FormValue("profit"),
-			PaidAt:   paidAt.UTC(),
-		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
 
-		a := strings.Join([]string{
-			c.MerchantID,
-			payment.Amount,
-			payment.ID,
-			c.APIKey,
-		}, ":")
-
-		hash := md5.Sum([]byte(a))
-		if r.FormValue("sign") != hex.EncodeToString(hash[:]) {
-			log.Println("checkout/anypay: bad signature")
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
+// networks are the addresses Anypay sends notifications from.
+var networks = checkout.MustParseNetworks(
+	"185.162.128.38",
+	"185.162.128.39",
+	"185.162.128.88",
+)
 
-		for k, v := range r.Form {
-			payment.Metadata[k] = v
-		}
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return networks
+}
 
-		if err := callback(payment); err != nil {
-			log.Println("checkout/anypay:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	return r.FormValue("pay_id") != "" && r.FormValue("sign") != "" &&
+		r.FormValue("merchant_id") == c.MerchantID
+}
 
-		w.WriteHeader(http.StatusOK)
-	})
+// Signature returns the expected sign of the notification form.
+func (c Checkout) Signature(form url.Values) string {
+	a := strings.Join([]string{
+		c.MerchantID,
+		form.Get("amount"),
+		form.Get("pay_id"),
+		c.APIKey,
+	}, ":")
+
+	hash := md5.Sum([]byte(a))
+	return hex.EncodeToString(hash[:])
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	if err := r.ParseForm(); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if r.FormValue("sign") != c.Signature(r.Form) {
+		return checkout.Payment{}, checkout.ErrBadSignature
+	}
+
+	paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("pay_date"), timeLoc)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	amount, err := checkout.ParseMoney(r.FormValue("amount"), r.FormValue("currency"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	profit, err := checkout.ParseMoney(r.FormValue("profit"), r.FormValue("currency"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	// Notifications without a status are only sent for paid payments.
+	status := checkout.StatusPaid
+	if s := r.FormValue("status"); s != "" {
+		status = statuses[s]
+	}
+
+	payment := checkout.Payment{
+		Checkout: "anypay",
+		ID:       r.FormValue("pay_id"),
+		Amount:   amount,
+		Metadata: make(checkout.Metadata),
+		Status:   status,
+		Profit:   profit,
+		PaidAt:   paidAt.UTC(),
+	}
+
+	for k, v := range r.Form {
+		payment.Metadata[k] = v
+	}
+
+	return payment, nil
 }
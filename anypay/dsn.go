@@ -0,0 +1,23 @@
+package anypay
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("anypay", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: anypay://merchant:key@?api_id=...&api_token=...&api_url=...
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		MerchantID: cfg.User,
+		APIKey:     cfg.Password,
+		APIID:      cfg.Get("api_id"),
+		APIToken:   cfg.Get("api_token"),
+		APIURL:     cfg.Get("api_url"),
+	}
+	if err := cfg.Require("merchant", c.MerchantID, "key", c.APIKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
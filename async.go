@@ -0,0 +1,179 @@
+package checkout
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultAsyncRetry is used by Async with a zero retry policy.
+var defaultAsyncRetry = RetryPolicy{
+	Attempts: 10,
+	MinDelay: time.Second,
+	MaxDelay: 10 * time.Minute,
+}
+
+// Async processes webhook events in the background. Its webhooks verify
+// the request, enqueue the payment and acknowledge it right away, while
+// the callback is called by a pool of workers started with Run.
+//
+// A failed callback is retried with backoff according to Retry and buried
+// in the queue's dead-letter list once the attempts are over. Events may
+// be processed more than once, e.g. after a crash, so the callback must
+// be idempotent.
+//
+// Example:
+//
+//	queue, _ := checkout.OpenFileQueue("/var/lib/bot/queue")
+//
+//	async := checkout.NewAsync(queue, callback)
+//	go async.Run(ctx)
+//
+//	http.Handle("/yookassa", async.Webhook(yoo))
+type Async struct {
+	Queue Queue
+	// Workers is the number of concurrent callbacks, 4 by default.
+	Workers int
+	// Retry is the policy of retrying callbacks. The zero value makes
+	// up to 10 attempts, from a second to 10 minutes apart.
+	Retry RetryPolicy
+	// Poll is how often idle workers check the queue, a second by default.
+	Poll time.Duration
+	// Logger is used to report failed callbacks.
+	Logger Logger
+
+	callback ContextCallback
+	wake     chan struct{}
+	once     sync.Once
+}
+
+// NewAsync returns an Async calling the callback for queued payments.
+func NewAsync(q Queue, callback ContextCallback) *Async {
+	return &Async{Queue: q, callback: callback}
+}
+
+// Callback returns a callback enqueueing payments. It may be passed to
+// any webhook, Mux or DedupWebhook.
+func (a *Async) Callback() ContextCallback {
+	return func(ctx context.Context, p Payment) error {
+		err := a.Queue.Push(ctx, Job{
+			ID:      DedupKey(p),
+			Payment: p,
+			NextAt:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case a.wakeup() <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+}
+
+// Webhook returns the checkout's webhook enqueueing payments.
+func (a *Async) Webhook(c Checkout) http.Handler {
+	return WebhookContext(c, a.Callback())
+}
+
+// Run processes queued jobs until the context is done.
+func (a *Async) Run(ctx context.Context) {
+	workers := a.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (a *Async) work(ctx context.Context) {
+	poll := a.Poll
+	if poll <= 0 {
+		poll = time.Second
+	}
+
+	t := time.NewTicker(poll)
+	defer t.Stop()
+
+	for ctx.Err() == nil {
+		j, ok, err := a.Queue.Pop(ctx)
+		if err != nil {
+			a.logger().Error("checkout: queue failed", "error", err)
+		}
+		if ok {
+			a.process(ctx, j)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-a.wakeup():
+		case <-t.C:
+		}
+	}
+}
+
+func (a *Async) process(ctx context.Context, j Job) {
+	j.Attempts++
+
+	err := a.callback(ctx, j.Payment)
+	if err == nil {
+		if err := a.Queue.Ack(ctx, j.ID); err != nil {
+			a.logger().Error("checkout: queue failed", "id", j.ID, "error", err)
+		}
+		return
+	}
+
+	retry := a.Retry
+	if retry.Attempts <= 0 {
+		retry = defaultAsyncRetry
+	}
+
+	j.LastError = err.Error()
+	delay, ok := retry.delay(j.Attempts, err)
+
+	if j.Attempts >= retry.Attempts || !ok {
+		a.logger().Error("checkout: callback failed, job buried", "id", j.ID, "attempts", j.Attempts, "error", err)
+		err = a.Queue.Bury(ctx, j)
+	} else {
+		a.logger().Warn("checkout: callback failed", "id", j.ID, "attempts", j.Attempts, "retry", delay, "error", err)
+		j.NextAt = time.Now().Add(delay)
+		err = a.Queue.Nack(ctx, j)
+	}
+	if err != nil {
+		a.logger().Error("checkout: queue failed", "id", j.ID, "error", err)
+	}
+}
+
+// Requeue moves the buried job back to the queue to be processed
+// with a fresh number of attempts.
+func (a *Async) Requeue(ctx context.Context, j Job) error {
+	j.Attempts = 0
+	j.NextAt = time.Now()
+	return a.Queue.Push(ctx, j)
+}
+
+func (a *Async) wakeup() chan struct{} {
+	a.once.Do(func() {
+		a.wake = make(chan struct{}, 1)
+	})
+	return a.wake
+}
+
+func (a *Async) logger() Logger {
+	if a.Logger == nil {
+		return DefaultLogger
+	}
+	return a.Logger
+}
@@ -0,0 +1,180 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidPayment means the payment can't be requested from the provider
+// as is, e.g. it has fields the provider would silently drop.
+var ErrInvalidPayment = errors.New("checkout: invalid payment")
+
+// ValidationError describes the field of the payment rejected by Validate.
+// It matches ErrInvalidPayment with errors.Is.
+type ValidationError struct {
+	Checkout string // provider name, e.g. "yookassa"
+	Field    string // Payment field name, e.g. "Metadata"
+	Reason   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("checkout/%s: invalid payment: %s %s", e.Checkout, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidPayment
+}
+
+type (
+	// Capabilities describes what a provider supports.
+	Capabilities struct {
+		Checkout string // provider name
+
+		Metadata   bool // Metadata is passed back in webhooks
+		Expiration bool // ExpirationDate is respected
+		Hold       bool // two-stage payments with Hold
+		Profit     bool // webhooks report the profit net of fees
+		Refunds    bool // the checkout implements Refunder
+
+		// Fields lists optional Payment fields sent to the provider,
+		// e.g. "Comment" or "SuccessURL".
+		Fields []string
+
+		// Currencies lists accepted currencies, the first one being
+		// the default. Empty means any currency.
+		Currencies []string
+
+		// MinAmount and MaxAmount limit the amount in their currency,
+		// unless zero.
+		MinAmount Money
+		MaxAmount Money
+
+		// MaxComment limits the comment length in characters, unless zero.
+		MaxComment int
+	}
+
+	// Validator is implemented by checkouts describing their capabilities.
+	// Every provider of this module implements it and validates payments
+	// before requesting them.
+	Validator interface {
+		Capabilities() Capabilities
+		// Validate reports a *ValidationError if the payment can't
+		// be requested as is.
+		Validate(Payment) error
+	}
+)
+
+// optionalFields lists optional fields with their values in a payment.
+var optionalFields = []struct {
+	name  string
+	value func(Payment) string
+}{
+	{"Comment", func(p Payment) string { return p.Comment }},
+	{"SuccessURL", func(p Payment) string { return p.SuccessURL }},
+	{"Target", func(p Payment) string { return p.Target }},
+	{"Type", func(p Payment) string { return p.Type }},
+	{"CallbackURL", func(p Payment) string { return p.CallbackURL }},
+	{"PaymentMethod", func(p Payment) string { return p.PaymentMethod }},
+	{"Customer", func(p Payment) string { return p.Customer }},
+}
+
+// Normalize returns the payment with the currency set to the only accepted
+// one if it's omitted. Checkouts request normalized payments.
+func (c Capabilities) Normalize(p Payment) Payment {
+	if p.Amount.Currency == "" && len(c.Currencies) == 1 {
+		p.Amount.Currency = c.Currencies[0]
+	}
+	return p
+}
+
+// Validate checks the payment against the capabilities.
+func (c Capabilities) Validate(p Payment) error {
+	invalid := func(field, reason string) error {
+		return &ValidationError{Checkout: c.Checkout, Field: field, Reason: reason}
+	}
+
+	if p.ID == "" {
+		return invalid("ID", "is required")
+	}
+	if !p.Amount.IsPositive() {
+		return invalid("Amount", "must be positive")
+	}
+
+	// A single accepted currency may be omitted.
+	amount := c.Normalize(p).Amount
+	if amount.Currency == "" && len(c.Currencies) > 1 {
+		return invalid("Amount", "has no currency")
+	}
+	if amount.Currency != "" {
+		if !c.Supports(amount.Currency) {
+			return invalid("Amount", "has unsupported currency "+amount.Currency)
+		}
+		cur, ok := LookupCurrency(amount.Currency)
+		if !ok {
+			return invalid("Amount", "has unknown currency "+amount.Currency)
+		}
+		if !amount.Value.Equal(amount.Value.Round(cur.MinorUnits)) {
+			return invalid("Amount", fmt.Sprintf("has more than %d decimal places", cur.MinorUnits))
+		}
+	}
+	if err := c.validateLimits(amount); err != nil {
+		return invalid("Amount", err.Error())
+	}
+
+	if c.MaxComment > 0 && utf8.RuneCountInString(p.Comment) > c.MaxComment {
+		return invalid("Comment", fmt.Sprintf("is longer than %d characters", c.MaxComment))
+	}
+
+	if len(p.Metadata) > 0 && !c.Metadata {
+		return invalid("Metadata", "is not supported")
+	}
+	if !p.ExpirationDate.IsZero() {
+		if !c.Expiration {
+			return invalid("ExpirationDate", "is not supported")
+		}
+		if p.ExpirationDate.Before(time.Now()) {
+			return invalid("ExpirationDate", "is in the past")
+		}
+	}
+	if p.Hold && !c.Hold {
+		return invalid("Hold", "is not supported")
+	}
+
+	for _, f := range optionalFields {
+		if f.value(p) != "" && !contains(c.Fields, f.name) {
+			return invalid(f.name, "is not supported")
+		}
+	}
+
+	return nil
+}
+
+// Supports reports whether the currency is accepted.
+func (c Capabilities) Supports(currency string) bool {
+	return len(c.Currencies) == 0 || contains(c.Currencies, currency)
+}
+
+func (c Capabilities) validateLimits(amount Money) error {
+	if !c.MinAmount.IsZero() && c.MinAmount.Currency == amount.Currency {
+		if cmp, _ := amount.Cmp(c.MinAmount); cmp < 0 {
+			return fmt.Errorf("is less than %s", c.MinAmount)
+		}
+	}
+	if !c.MaxAmount.IsZero() && c.MaxAmount.Currency == amount.Currency {
+		if cmp, _ := amount.Cmp(c.MaxAmount); cmp > 0 {
+			return fmt.Errorf("is greater than %s", c.MaxAmount)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,11 @@
 package checkout
 
 import (
+	"context"
 	"net/http"
 	"time"
 )
 
-// Currencies.
-const (
-	RUB = "RUB"
-	UAH = "UAH"
-	USD = "USD"
-)
-
-// Statuses.
-const (
-	StatusPaid = 1 + iota
-	StatusWaiting
-	StatusExpired
-	StatusRejected
-)
-
 type (
 	// Checkout provides two primary operations from a chosen payment acquiring.
 	Checkout interface {
@@ -30,11 +16,47 @@ type (
 		Webhook(Callback) http.Handler
 	}
 
+	// ContextCheckout is a Checkout that propagates a context through both
+	// of its operations. Every provider of this module implements it.
+	ContextCheckout interface {
+		Checkout
+		// RequestContext is like Request, but uses ctx for any outgoing calls.
+		RequestContext(context.Context, Payment) (string, error)
+		// WebhookContext is like Webhook, but passes the incoming request's
+		// context to the callback.
+		WebhookContext(ContextCallback) http.Handler
+	}
+
+	// Fetcher is implemented by checkouts able to look up the current
+	// state of a payment through the provider's API.
+	Fetcher interface {
+		// Payment returns the payment with the given ID, normalized
+		// the same way as webhooks do.
+		Payment(ctx context.Context, id string) (Payment, error)
+	}
+
+	// Parser is implemented by checkouts able to decode a webhook
+	// without answering it or calling the provider, e.g. to verify
+	// a captured one.
+	Parser interface {
+		// Parse checks the webhook's signature and returns its payment.
+		Parse(*http.Request) (Payment, error)
+	}
+
+	// Capturer is implemented by checkouts supporting two-stage payments.
+	// Such a payment is requested with Payment.Hold and reported with
+	// StatusWaitingForCapture once the funds are held.
+	Capturer interface {
+		// Capture charges the held payment. A zero amount captures it in full.
+		Capture(ctx context.Context, id string, amount Money) (Payment, error)
+		// Void cancels the held payment, releasing the funds.
+		Void(ctx context.Context, id string) (Payment, error)
+	}
+
 	// Payment represents a universal payment object.
 	Payment struct {
 		ID         string
-		Amount     string
-		Currency   string
+		Amount     Money
 		Comment    string
 		SuccessURL string
 		Metadata   Metadata
@@ -43,12 +65,13 @@ type (
 		Type           string    // yoomoney, paymaster only
 		ExpirationDate time.Time // qiwi,paymaster only
 		CallbackURL    string    // paymaster only
-		PaymentMethod  string    // paymaster only
+		PaymentMethod  string    // paymaster and yookassa
 		Customer       string    // paymaster only
+		Hold           bool      // yookassa, paymaster only
 
 		Checkout string    // in callback only
-		Status   int       // in callback only
-		Profit   string    // in callback only
+		Status   Status    // in callback only
+		Profit   Money     // in callback only
 		PaidAt   time.Time // in callback only
 
 		// V is a special field set by a checkout implementation. It stores an
@@ -67,4 +90,52 @@ type (
 
 	// Callback is a function called by a checkout as a result of webhook triggering.
 	Callback = func(Payment) error
+
+	// ContextCallback is a Callback receiving the webhook's request context.
+	ContextCallback = func(context.Context, Payment) error
 )
+
+// WithoutContext adapts a Callback to the ContextCallback signature.
+func WithoutContext(callback Callback) ContextCallback {
+	return func(_ context.Context, p Payment) error {
+		return callback(p)
+	}
+}
+
+// Unwrap returns the checkout wrapped by c, e.g. with FilterIPs, or c
+// itself if it's not a wrapper. Wrappers implement Checkout and
+// ContextCheckout only, so optional interfaces are probed on the result:
+//
+//	r, ok := checkout.Unwrap(c).(checkout.Refunder)
+func Unwrap(c Checkout) Checkout {
+	for {
+		w, ok := c.(interface{ Unwrap() Checkout })
+		if !ok {
+			return c
+		}
+		c = w.Unwrap()
+	}
+}
+
+// RequestContext calls c.RequestContext if c implements ContextCheckout,
+// falling back to c.Request otherwise.
+func RequestContext(ctx context.Context, c Checkout, p Payment) (string, error) {
+	if cc, ok := c.(ContextCheckout); ok {
+		return cc.RequestContext(ctx, p)
+	}
+	return c.Request(p)
+}
+
+// WebhookContext calls c.WebhookContext if c implements ContextCheckout.
+// Otherwise, it wraps c.Webhook so that the callback still receives
+// the request's context.
+func WebhookContext(c Checkout, callback ContextCallback) http.Handler {
+	if cc, ok := c.(ContextCheckout); ok {
+		return cc.WebhookContext(callback)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Webhook(func(p Payment) error {
+			return callback(r.Context(), p)
+		}).ServeHTTP(w, r)
+	})
+}
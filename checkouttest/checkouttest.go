@@ -0,0 +1,171 @@
+// Package checkouttest builds webhook requests signed the same way
+// as every provider signs them, to drive real webhook handlers in tests.
+//
+// Example:
+//
+//	co := payeer.Checkout{MerchantID: "1", APIKey: "secret"}
+//
+//	r, _ := checkouttest.Webhook(co, checkout.Payment{
+//		ID:     "42",
+//		Amount: checkout.MustParseMoney("100.00", checkout.RUB),
+//		Status: checkout.StatusPaid,
+//	})
+//
+//	w := httptest.NewRecorder()
+//	co.Webhook(callback).ServeHTTP(w, r)
+package checkouttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/anypay"
+	"go.massbots.xyz/checkout/enotio"
+	"go.massbots.xyz/checkout/payeer"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/qiwi"
+	"go.massbots.xyz/checkout/stars"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yoomoney"
+)
+
+// Fault is a deliberate defect of a webhook request.
+type Fault int
+
+const (
+	// BadSignature signs the request with a wrong key.
+	BadSignature Fault = 1 + iota
+	// TamperedAmount changes the amount after the request is signed.
+	TamperedAmount
+	// Malformed replaces the request body with garbage.
+	Malformed
+)
+
+// ErrUnsupported is returned for checkouts or faults unknown to the package.
+var ErrUnsupported = errors.New("checkouttest: unsupported")
+
+// Webhook returns a webhook request notifying about the payment,
+// signed for the given checkout.
+func Webhook(c checkout.Checkout, p checkout.Payment) (*http.Request, error) {
+	return build(c, p, 0)
+}
+
+// Forge is like Webhook, but the request has the given defect,
+// so that the checkout must reject it.
+func Forge(c checkout.Checkout, p checkout.Payment, fault Fault) (*http.Request, error) {
+	return build(c, p, fault)
+}
+
+// Do serves the webhook request of the payment by the handler
+// and returns the recorded response.
+func Do(h http.Handler, c checkout.Checkout, p checkout.Payment) (*httptest.ResponseRecorder, error) {
+	r, err := Webhook(c, p)
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w, nil
+}
+
+func build(c checkout.Checkout, p checkout.Payment, fault Fault) (*http.Request, error) {
+	if p.PaidAt.IsZero() {
+		p.PaidAt = time.Now()
+	}
+	if p.Status == checkout.StatusUnknown {
+		p.Status = checkout.StatusPaid
+	}
+
+	switch c := c.(type) {
+	case anypay.Checkout:
+		return formRequest(anypayForm(c, p, fault), fault)
+	case *anypay.Checkout:
+		return formRequest(anypayForm(*c, p, fault), fault)
+	case enotio.Checkout:
+		return formRequest(enotioForm(c, p, fault), fault)
+	case *enotio.Checkout:
+		return formRequest(enotioForm(*c, p, fault), fault)
+	case payeer.Checkout:
+		return formRequest(payeerForm(c, p, fault), fault)
+	case *payeer.Checkout:
+		return formRequest(payeerForm(*c, p, fault), fault)
+	case yoomoney.Checkout:
+		return formRequest(yoomoneyForm(c, p, fault), fault)
+	case *yoomoney.Checkout:
+		return formRequest(yoomoneyForm(*c, p, fault), fault)
+	case qiwi.Checkout:
+		return qiwiRequest(c, p, fault)
+	case *qiwi.Checkout:
+		return qiwiRequest(*c, p, fault)
+	case telegram.Checkout:
+		return telegramRequest(c, p, fault)
+	case *telegram.Checkout:
+		return telegramRequest(*c, p, fault)
+	case stars.Checkout:
+		return telegramRequest(c.Bot(), p, fault)
+	case *stars.Checkout:
+		return telegramRequest(c.Bot(), p, fault)
+	case yookassa.Checkout, *yookassa.Checkout:
+		return jsonRequest(yookassaEvent(p), fault)
+	case paymaster.Checkout:
+		return jsonRequest(paymasterPayment(c, p), fault)
+	case *paymaster.Checkout:
+		return jsonRequest(paymasterPayment(*c, p), fault)
+	}
+
+	return nil, fmt.Errorf("%w: checkout %T", ErrUnsupported, c)
+}
+
+func formRequest(form url.Values, fault Fault) (*http.Request, error) {
+	body := form.Encode()
+	if fault == Malformed {
+		body = "%%%"
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r, nil
+}
+
+func jsonRequest(v any, fault Fault) (*http.Request, error) {
+	if fault == BadSignature || fault == TamperedAmount {
+		return nil, fmt.Errorf("%w: the provider doesn't sign webhooks", ErrUnsupported)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if fault == Malformed {
+		data = data[:len(data)/2]
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+	return r, nil
+}
+
+// tamper returns a different amount of the same format.
+func tamper(amount string) string {
+	m, err := checkout.ParseMoney(amount, "")
+	if err != nil {
+		return amount + "1"
+	}
+	return m.Value.Add(m.Value).StringFixed(2)
+}
+
+func metadataForm(form url.Values, md checkout.Metadata) {
+	for k, v := range md {
+		form.Set(k, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,159 @@
+package checkouttest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/anypay"
+	"go.massbots.xyz/checkout/checkouttest"
+	"go.massbots.xyz/checkout/enotio"
+	"go.massbots.xyz/checkout/payeer"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/qiwi"
+	"go.massbots.xyz/checkout/stars"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yoomoney"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+var checkouts = []struct {
+	name     string
+	checkout checkout.Checkout
+	amount   checkout.Money
+	// signed means forged signatures and amounts are rejected.
+	signed bool
+}{
+	{"anypay", anypay.Checkout{MerchantID: "1", APIKey: "key", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), true},
+	{"enotio", enotio.Checkout{MerchantID: "1", APIKey1: "key1", APIKey2: "key2", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), true},
+	{"payeer", payeer.Checkout{MerchantID: "1", APIKey: "key", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), true},
+	{"yoomoney", yoomoney.Checkout{Receiver: "4100", SecretKey: "key", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), true},
+	{"qiwi", qiwi.Checkout{PublicKey: "public", SecretKey: "key", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), true},
+	{"yookassa", yookassa.Checkout{ShopID: "1", APIKey: "key", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), false},
+	{"paymaster", paymaster.Checkout{MerchantID: "1", Token: "token", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), false},
+	{"telegram", telegram.Checkout{Token: "1:token", SecretToken: "secret", Logger: nopLogger{}}, checkout.MustParseMoney("100.00", checkout.RUB), false},
+	{"stars", stars.Checkout{Token: "1:token", Title: "Stars", SecretToken: "secret", Logger: nopLogger{}}, checkout.FromMinor(50, checkout.XTR), false},
+}
+
+func TestWebhook(t *testing.T) {
+	for _, tt := range checkouts {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []checkout.Payment
+			h := checkout.WebhookContext(tt.checkout, func(_ context.Context, p checkout.Payment) error {
+				got = append(got, p)
+				return nil
+			})
+
+			w, err := checkouttest.Do(h, tt.checkout, checkout.Payment{
+				ID:     "42",
+				Amount: tt.amount,
+				Status: checkout.StatusPaid,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status code = %d, want 200", w.Code)
+			}
+			if len(got) != 1 {
+				t.Fatalf("callback called %d times, want 1", len(got))
+			}
+
+			p := got[0]
+			if p.ID != "42" {
+				t.Errorf("ID = %q, want 42", p.ID)
+			}
+			if !p.Amount.Equal(tt.amount) {
+				t.Errorf("Amount = %s, want %s", p.Amount, tt.amount)
+			}
+			if p.Status != checkout.StatusPaid {
+				t.Errorf("Status = %s, want paid", p.Status)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range checkouts {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, ok := tt.checkout.(checkout.Parser)
+			if !ok {
+				t.Fatalf("%T doesn't implement checkout.Parser", tt.checkout)
+			}
+
+			r, err := checkouttest.Webhook(tt.checkout, checkout.Payment{
+				ID:     "42",
+				Amount: tt.amount,
+				Status: checkout.StatusPaid,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := parser.Parse(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.ID != "42" || !p.Amount.Equal(tt.amount) || p.Status != checkout.StatusPaid {
+				t.Errorf("Parse = %+v", p)
+			}
+		})
+	}
+}
+
+func TestForge(t *testing.T) {
+	faults := []struct {
+		name  string
+		fault checkouttest.Fault
+	}{
+		{"bad_signature", checkouttest.BadSignature},
+		{"tampered_amount", checkouttest.TamperedAmount},
+		{"malformed", checkouttest.Malformed},
+	}
+
+	for _, tt := range checkouts {
+		for _, f := range faults {
+			t.Run(tt.name+"/"+f.name, func(t *testing.T) {
+				r, err := checkouttest.Forge(tt.checkout, checkout.Payment{
+					ID:     "42",
+					Amount: tt.amount,
+					Status: checkout.StatusPaid,
+				}, f.fault)
+				if errors.Is(err, checkouttest.ErrUnsupported) {
+					if tt.signed {
+						t.Fatal(err)
+					}
+					t.Skip(err)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				called := false
+				h := checkout.WebhookContext(tt.checkout, func(context.Context, checkout.Payment) error {
+					called = true
+					return nil
+				})
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if called {
+					t.Error("callback called for a forged webhook")
+				}
+				if w.Code == http.StatusOK {
+					t.Error("forged webhook accepted with 200")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package checkouttest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/anypay"
+	"go.massbots.xyz/checkout/enotio"
+	"go.massbots.xyz/checkout/payeer"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/qiwi"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yoomoney"
+)
+
+const wrongKey = "checkouttest-wrong-key"
+
+var moscow, _ = time.LoadLocation("Europe/Moscow")
+
+var anypayStatuses = map[checkout.Status]string{
+	checkout.StatusPaid:     "paid",
+	checkout.StatusWaiting:  "waiting",
+	checkout.StatusRefunded: "refund",
+	checkout.StatusCanceled: "canceled",
+	checkout.StatusExpired:  "expired",
+	checkout.StatusRejected: "error",
+}
+
+func anypayForm(c anypay.Checkout, p checkout.Payment, fault Fault) url.Values {
+	form := url.Values{}
+	metadataForm(form, p.Metadata)
+	form.Set("merchant_id", c.MerchantID)
+	form.Set("transaction_id", "1")
+	form.Set("pay_id", p.ID)
+	form.Set("amount", p.Amount.Format())
+	form.Set("currency", p.Amount.Currency)
+	form.Set("profit", p.Profit.Format())
+	form.Set("status", anypayStatuses[p.Status])
+	form.Set("pay_date", p.PaidAt.In(moscow).Format("02.01.2006 15:04:05"))
+
+	if fault == BadSignature {
+		c.APIKey = wrongKey
+	}
+	form.Set("sign", c.Signature(form))
+
+	if fault == TamperedAmount {
+		form.Set("amount", tamper(form.Get("amount")))
+	}
+	return form
+}
+
+func enotioForm(c enotio.Checkout, p checkout.Payment, fault Fault) url.Values {
+	var custom []string
+	for k, v := range p.Metadata {
+		custom = append(custom, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(custom)
+
+	form := url.Values{}
+	form.Set("merchant", c.MerchantID)
+	form.Set("merchant_id", p.ID)
+	form.Set("intid", "1")
+	form.Set("amount", p.Amount.Format())
+	form.Set("credited", p.Profit.Format())
+	form.Set("currency", p.Amount.Currency)
+	form.Set("custom_field", url.QueryEscape(strings.Join(custom, ",")))
+
+	if fault == BadSignature {
+		c.APIKey2 = wrongKey
+	}
+	form.Set("sign_2", c.Signature(form))
+
+	if fault == TamperedAmount {
+		form.Set("amount", tamper(form.Get("amount")))
+	}
+	return form
+}
+
+var payeerStatuses = map[checkout.Status]string{
+	checkout.StatusPaid:     "success",
+	checkout.StatusRejected: "fail",
+}
+
+func payeerForm(c payeer.Checkout, p checkout.Payment, fault Fault) url.Values {
+	date := p.PaidAt.In(moscow).Format("02.01.2006 15:04:05")
+
+	form := url.Values{}
+	form.Set("m_operation_id", "1")
+	form.Set("m_operation_ps", "2609")
+	form.Set("m_operation_date", date)
+	form.Set("m_operation_pay_date", date)
+	form.Set("m_shop", c.MerchantID)
+	form.Set("m_orderid", p.ID)
+	form.Set("m_amount", p.Amount.Format())
+	form.Set("m_curr", p.Amount.Currency)
+	form.Set("m_desc", base64.StdEncoding.EncodeToString([]byte(p.Comment)))
+	form.Set("m_status", payeerStatuses[p.Status])
+	if !p.Profit.IsZero() {
+		form.Set("summa_out", p.Profit.Format())
+	}
+
+	if fault == BadSignature {
+		c.APIKey = wrongKey
+	}
+	form.Set("m_sign", c.Signature(form))
+
+	if fault == TamperedAmount {
+		form.Set("m_amount", tamper(form.Get("m_amount")))
+	}
+	return form
+}
+
+func yoomoneyForm(c yoomoney.Checkout, p checkout.Payment, fault Fault) url.Values {
+	profit := p.Profit
+	if profit.IsZero() {
+		profit = p.Amount
+	}
+
+	form := url.Values{}
+	form.Set("notification_type", "card-incoming")
+	form.Set("operation_id", "1")
+	form.Set("amount", profit.StringFixed(2))
+	form.Set("withdraw_amount", p.Amount.StringFixed(2))
+	form.Set("currency", "643")
+	form.Set("datetime", p.PaidAt.In(moscow).Format("2006-01-02T15:04:05Z"))
+	form.Set("sender", "")
+	form.Set("codepro", "false")
+	form.Set("label", p.ID)
+	if p.Status == checkout.StatusWaiting {
+		form.Set("unaccepted", "true")
+	}
+
+	if fault == BadSignature {
+		c.SecretKey = wrongKey
+	}
+	form.Set("sha1_hash", c.Signature(form))
+
+	if fault == TamperedAmount {
+		form.Set("amount", tamper(form.Get("amount")))
+	}
+	return form
+}
+
+var qiwiStatuses = map[checkout.Status]string{
+	checkout.StatusWaiting:  "WAITING",
+	checkout.StatusPaid:     "PAID",
+	checkout.StatusRejected: "REJECTED",
+	checkout.StatusExpired:  "EXPIRED",
+}
+
+func qiwiRequest(c qiwi.Checkout, p checkout.Payment, fault Fault) (*http.Request, error) {
+	var bill qiwi.Payment
+	bill.SiteID = c.PublicKey
+	bill.BillID = p.ID
+	bill.Comment = p.Comment
+	bill.CustomFields = p.Metadata
+	bill.CreationDateTime = p.PaidAt.Format("2006-01-02T15:04:05-07")
+	bill.Amount = qiwi.Amount{Value: p.Amount.StringFixed(2), Currency: p.Amount.Currency}
+	bill.Status.Value = qiwiStatuses[p.Status]
+	bill.Status.ChangedDateTime = bill.CreationDateTime
+
+	signer := c
+	if fault == BadSignature {
+		signer.SecretKey = wrongKey
+	}
+	sign := signer.Signature(bill)
+
+	if fault == TamperedAmount {
+		bill.Amount.Value = tamper(bill.Amount.Value)
+	}
+
+	var jsonFault Fault
+	if fault == Malformed {
+		jsonFault = Malformed
+	}
+
+	r, err := jsonRequest(map[string]any{"bill": bill}, jsonFault)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("X-Api-Signature-SHA256", sign)
+	return r, nil
+}
+
+var yookassaStatuses = map[checkout.Status]string{
+	checkout.StatusWaiting:           "pending",
+	checkout.StatusWaitingForCapture: "waiting_for_capture",
+	checkout.StatusPaid:              "succeeded",
+	checkout.StatusRejected:          "canceled",
+	checkout.StatusCanceled:          "canceled",
+}
+
+func yookassaEvent(p checkout.Payment) yookassa.Event {
+	status := yookassaStatuses[p.Status]
+
+	var object yookassa.Payment
+	object.ID = p.ID
+	object.Status = status
+	object.Paid = p.Status == checkout.StatusPaid
+	object.Amount = yookassa.Amount{Value: p.Amount.StringFixed(2), Currency: p.Amount.Currency}
+	object.Created = p.PaidAt
+	object.Captured = p.PaidAt
+	object.Description = p.Comment
+	object.Metadata = p.Metadata
+	if !p.Profit.IsZero() {
+		object.Income = yookassa.Amount{Value: p.Profit.StringFixed(2), Currency: p.Profit.Currency}
+	}
+	if p.Status == checkout.StatusCanceled {
+		object.Cancellation.Party = "merchant"
+	}
+
+	return yookassa.Event{
+		Type:   "notification",
+		Name:   "payment." + status,
+		Object: object,
+	}
+}
+
+var paymasterStatuses = map[checkout.Status]string{
+	checkout.StatusWaiting:           "Pending",
+	checkout.StatusWaitingForCapture: "Authorized",
+	checkout.StatusPaid:              "Settled",
+	checkout.StatusCanceled:          "Cancelled",
+	checkout.StatusRejected:          "Rejected",
+}
+
+func paymasterPayment(c paymaster.Checkout, p checkout.Payment) paymaster.Payment {
+	id, _ := strconv.Atoi(p.ID)
+	return paymaster.Payment{
+		ID:         id,
+		MerchantID: c.MerchantID,
+		CreatedAt:  p.PaidAt,
+		Status:     paymasterStatuses[p.Status],
+		Invoice: paymaster.Invoice{
+			Description: p.Comment,
+			Params:      p.Metadata,
+		},
+		Amount: paymaster.Amount{
+			Value:    p.Amount.StringFixed(2),
+			Currency: p.Amount.Currency,
+		},
+	}
+}
+
+func telegramRequest(c telegram.Checkout, p checkout.Payment, fault Fault) (*http.Request, error) {
+	if p.Status != checkout.StatusPaid {
+		return nil, fmt.Errorf("%w: telegram only notifies of paid payments", ErrUnsupported)
+	}
+	if fault == TamperedAmount || (fault == BadSignature && c.SecretToken == "") {
+		return nil, fmt.Errorf("%w: the provider doesn't sign webhooks", ErrUnsupported)
+	}
+
+	var jsonFault Fault
+	if fault == Malformed {
+		jsonFault = Malformed
+	}
+
+	r, err := jsonRequest(telegram.Update{
+		UpdateID: 1,
+		Message: &telegram.Message{
+			MessageID: 1,
+			From:      &telegram.User{ID: 1},
+			Chat:      telegram.Chat{ID: 1, Type: "private"},
+			Date:      p.PaidAt.Unix(),
+			SuccessfulPayment: &telegram.SuccessfulPayment{
+				Currency:                p.Amount.Currency,
+				TotalAmount:             p.Amount.Minor(),
+				InvoicePayload:          p.ID,
+				TelegramPaymentChargeID: "test-" + p.ID,
+			},
+		},
+	}, jsonFault)
+	if err != nil {
+		return nil, err
+	}
+
+	token := c.SecretToken
+	if fault == BadSignature {
+		token = wrongKey
+	}
+	if token != "" {
+		r.Header.Set(telegram.SecretTokenHeader, token)
+	}
+	return r, nil
+}
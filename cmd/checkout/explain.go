@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/anypay"
+	"go.massbots.xyz/checkout/enotio"
+	"go.massbots.xyz/checkout/payeer"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/qiwi"
+	"go.massbots.xyz/checkout/stars"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yoomoney"
+)
+
+// signed describes the signature of a webhook.
+type signed struct {
+	// field is the form field or the header carrying the signature.
+	field     string
+	algorithm string
+	parts     []part
+	expected  string
+	got       string
+	// secret means the signature is a secret itself, so it's never printed.
+	secret bool
+	// hints are checks of the webhook specific to the provider.
+	hints []string
+}
+
+// part is a value the signature is computed of.
+type part struct {
+	name   string
+	value  string
+	secret bool
+	// missing means the webhook lacks the value.
+	missing bool
+}
+
+func formPart(form url.Values, name string) part {
+	_, ok := form[name]
+	return part{name: name, value: form.Get(name), missing: !ok}
+}
+
+func secretPart(name, value string) part {
+	return part{name: name, value: value, secret: true}
+}
+
+// fingerprint describes the secret without revealing it, so that
+// two secrets can still be told apart.
+func fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return fmt.Sprintf("<%d characters, sha256 %x...>", len(secret), sum[:4])
+}
+
+// show returns the signature as is, or its fingerprint if it's a secret.
+func (s signed) show(signature string) string {
+	if s.secret && signature != "" {
+		return fingerprint(signature)
+	}
+	return signature
+}
+
+func unsigned(c checkout.Checkout) bool {
+	if s, ok := c.(stars.Checkout); ok {
+		c = s.Bot()
+	}
+	switch c := c.(type) {
+	case yookassa.Checkout, paymaster.Checkout:
+		return true
+	case telegram.Checkout:
+		return c.SecretToken == ""
+	}
+	return false
+}
+
+// signedByHeader reports whether the signature is sent in a header.
+func signedByHeader(c checkout.Checkout) bool {
+	switch c.(type) {
+	case qiwi.Checkout, telegram.Checkout, stars.Checkout:
+		return true
+	}
+	return false
+}
+
+// signature computes the expected signature of the webhook body
+// with the checkout's secrets.
+func signature(c checkout.Checkout, body []byte) (signed, error) {
+	if unsigned(c) {
+		return signed{}, fmt.Errorf("checkout: %T doesn't sign notifications", c)
+	}
+
+	if !signedByHeader(c) && isJSON(body) {
+		return signed{}, errors.New("checkout: the provider sends forms, not JSON")
+	}
+	form, err := url.ParseQuery(strings.TrimSpace(string(body)))
+	if err != nil {
+		form = url.Values{}
+	}
+
+	if s, ok := c.(stars.Checkout); ok {
+		c = s.Bot()
+	}
+
+	var s signed
+	switch c := c.(type) {
+	case anypay.Checkout:
+		s = signed{
+			field:     "sign",
+			algorithm: "md5 of the values joined by \":\"",
+			parts: []part{
+				{name: "merchant ID (DSN)", value: c.MerchantID},
+				formPart(form, "amount"),
+				formPart(form, "pay_id"),
+				secretPart("secret key (DSN)", c.APIKey),
+			},
+			expected: c.Signature(form),
+		}
+		if id := form.Get("merchant_id"); id != "" && id != c.MerchantID {
+			s.hints = append(s.hints, fmt.Sprintf("the webhook is for merchant %q, the DSN has %q", id, c.MerchantID))
+		}
+	case enotio.Checkout:
+		s = signed{
+			field:     "sign_2",
+			algorithm: "md5 of the values joined by \":\"",
+			parts: []part{
+				{name: "merchant ID (DSN)", value: c.MerchantID},
+				formPart(form, "amount"),
+				secretPart("second secret key (DSN)", c.APIKey2),
+				formPart(form, "merchant_id"),
+			},
+			expected: c.Signature(form),
+		}
+		if id := form.Get("merchant"); id != "" && id != c.MerchantID {
+			s.hints = append(s.hints, fmt.Sprintf("the webhook is for merchant %q, the DSN has %q", id, c.MerchantID))
+		}
+	case payeer.Checkout:
+		s = signed{
+			field:     "m_sign",
+			algorithm: "upper-case sha256 of the values joined by \":\"",
+			expected:  c.Signature(form),
+		}
+		for _, name := range []string{
+			"m_operation_id", "m_operation_ps", "m_operation_date", "m_operation_pay_date",
+			"m_shop", "m_orderid", "m_amount", "m_curr", "m_desc", "m_status",
+		} {
+			s.parts = append(s.parts, formPart(form, name))
+		}
+		if form.Get("m_params") != "" {
+			s.parts = append(s.parts, formPart(form, "m_params"))
+		}
+		s.parts = append(s.parts, secretPart("secret key (DSN)", c.APIKey))
+
+		if id := form.Get("m_shop"); id != "" && id != c.MerchantID {
+			s.hints = append(s.hints, fmt.Sprintf("the webhook is for shop %q, the DSN has %q", id, c.MerchantID))
+		}
+	case yoomoney.Checkout:
+		s = signed{
+			field:     "sha1_hash",
+			algorithm: "sha1 of the values joined by \"&\"",
+			expected:  c.Signature(form),
+		}
+		for _, name := range []string{
+			"notification_type", "operation_id", "amount", "currency",
+			"datetime", "sender", "codepro",
+		} {
+			s.parts = append(s.parts, formPart(form, name))
+		}
+		s.parts = append(s.parts, secretPart("secret (DSN)", c.SecretKey), formPart(form, "label"))
+	case qiwi.Checkout:
+		var bill struct {
+			Payment *qiwi.Payment `json:"bill"`
+		}
+		if err := json.Unmarshal(body, &bill); err != nil || bill.Payment == nil {
+			return signed{}, errors.New("checkout: the body is not a Qiwi bill notification")
+		}
+
+		p := *bill.Payment
+		s = signed{
+			field:     "X-Api-Signature-SHA256",
+			algorithm: "hmac-sha256 of the values joined by \"|\", keyed by the secret key",
+			parts: []part{
+				{name: "bill.amount.currency", value: p.Amount.Currency, missing: p.Amount.Currency == ""},
+				{name: "bill.amount.value", value: p.Amount.Value, missing: p.Amount.Value == ""},
+				{name: "bill.billId", value: p.BillID, missing: p.BillID == ""},
+				{name: "bill.siteId", value: p.SiteID, missing: p.SiteID == ""},
+				{name: "bill.status.value", value: p.Status.Value, missing: p.Status.Value == ""},
+				secretPart("secret key (DSN)", c.SecretKey),
+			},
+			expected: c.Signature(p),
+		}
+	case telegram.Checkout:
+		s = signed{
+			field:     telegram.SecretTokenHeader,
+			algorithm: "the secret_token the webhook is set with, sent as is",
+			parts:     []part{secretPart("secret token (DSN)", c.SecretToken)},
+			expected:  c.SecretToken,
+			secret:    true,
+		}
+	default:
+		return signed{}, fmt.Errorf("checkout: signatures of %T are unknown", c)
+	}
+
+	s.got = form.Get(s.field)
+	return s, nil
+}
+
+// explain describes why the checkout has rejected the webhook
+// with the given error.
+func explain(w io.Writer, c checkout.Checkout, r *http.Request, err error) {
+	body, _ := io.ReadAll(r.Body)
+
+	if errors.Is(err, checkout.ErrMalformedPayload) {
+		fmt.Fprintln(w, "The body is malformed: it can't be decoded, or a field has an unexpected format.")
+		if isJSON(body) {
+			fmt.Fprintln(w, "It was sent as JSON.")
+		} else {
+			fmt.Fprintln(w, "It was sent as a URL-encoded form.")
+		}
+		return
+	}
+
+	if unsigned(c) {
+		fmt.Fprintln(w, "The provider doesn't sign notifications, so the rejection isn't caused by a signature.")
+		return
+	}
+
+	s, err := signature(c, body)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	if signedByHeader(c) {
+		s.got = r.Header.Get(s.field)
+	}
+
+	fmt.Fprintf(w, "Signature:  %s\n", s.field)
+	fmt.Fprintf(w, "Algorithm:  %s\n", s.algorithm)
+	fmt.Fprintf(w, "Received:   %s\n", orNone(s.show(s.got)))
+	fmt.Fprintf(w, "Expected:   %s\n\n", s.show(s.expected))
+
+	fmt.Fprintln(w, "Signed values, in order:")
+	var missing []string
+	for _, p := range s.parts {
+		switch {
+		case p.secret:
+			fmt.Fprintf(w, "  %-24s <%d characters>\n", p.name, len(p.value))
+		case p.missing:
+			fmt.Fprintf(w, "  %-24s MISSING\n", p.name)
+			missing = append(missing, p.name)
+		default:
+			fmt.Fprintf(w, "  %-24s %q\n", p.name, p.value)
+		}
+	}
+	fmt.Fprintln(w)
+
+	hints := s.hints
+	switch {
+	case s.got == "":
+		hints = append(hints, fmt.Sprintf("the webhook has no %s", s.field))
+	case s.got == s.expected:
+		hints = append(hints, "the signature matches, the webhook is rejected for another reason")
+	case strings.EqualFold(s.got, s.expected):
+		hints = append(hints, "the signatures differ in letter case only")
+	}
+	if len(missing) > 0 {
+		hints = append(hints, "the webhook lacks signed values: "+strings.Join(missing, ", "))
+	}
+	for _, p := range s.parts {
+		if strings.TrimSpace(p.value) != p.value {
+			hints = append(hints, fmt.Sprintf("%s has leading or trailing spaces", p.name))
+		}
+	}
+	if len(hints) == 0 {
+		hints = append(hints,
+			"all signed values are present, so the secret key differs from the provider's one,",
+			"or the body was changed on its way, e.g. re-encoded by a proxy")
+	}
+
+	fmt.Fprintln(w, "Probable cause:")
+	for _, h := range hints {
+		fmt.Fprintf(w, "  %s\n", h)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,434 @@
+// Command checkout debugs payment integrations: it builds payment links,
+// verifies captured webhooks, computes their signatures and sends signed
+// fake webhooks to a local endpoint.
+//
+// The checkout is configured by a DSN passed with -dsn or the CHECKOUT_DSN
+// environment variable, e.g. "payeer://merchant:key@".
+//
+// Usage:
+//
+//	checkout [-dsn DSN] link -id 42 -amount 100.00 [-currency RUB] [-meta key=value] [-qr link.png]
+//	checkout [-dsn DSN] verify [-H "Name: value"] [-remote IP] [file]
+//	checkout [-dsn DSN] sign [file]
+//	checkout [-dsn DSN] simulate -url URL -id 42 -amount 100.00 [-status paid]
+//	checkout providers
+//
+// Webhook bodies are read from the file, or from the standard input if
+// there is none. Bodies starting with "{" are sent as JSON, others as
+// URL-encoded forms.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/checkouttest"
+	"go.massbots.xyz/checkout/qr"
+
+	_ "go.massbots.xyz/checkout/anypay"
+	_ "go.massbots.xyz/checkout/enotio"
+	_ "go.massbots.xyz/checkout/payeer"
+	_ "go.massbots.xyz/checkout/paymaster"
+	_ "go.massbots.xyz/checkout/qiwi"
+	_ "go.massbots.xyz/checkout/stars"
+	_ "go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/yookassa"
+	_ "go.massbots.xyz/checkout/yoomoney"
+)
+
+const usage = `Usage: checkout [-dsn DSN] <command> [flags]
+
+Commands:
+  link       build a payment link
+  verify     verify a captured webhook and explain failures
+  sign       compute the expected signature of a webhook
+  simulate   send a signed fake webhook
+  providers  list available providers
+
+The DSN defaults to $CHECKOUT_DSN. Run "checkout <command> -h" for flags.
+`
+
+// errFailed means the command has already reported its failure.
+var errFailed = errors.New("failed")
+
+func main() {
+	log.SetFlags(0)
+
+	fs := flag.NewFlagSet("checkout", flag.ExitOnError)
+	dsn := fs.String("dsn", os.Getenv("CHECKOUT_DSN"), "checkout `DSN`")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	if cmd == "providers" {
+		for _, name := range checkout.Providers() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	commands := map[string]func(checkout.Checkout, []string) error{
+		"link":     link,
+		"verify":   verify,
+		"sign":     sign,
+		"simulate": simulate,
+	}
+
+	run, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "checkout: unknown command %q\n\n", cmd)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *dsn == "" {
+		log.Fatal("checkout: no DSN, set -dsn or CHECKOUT_DSN")
+	}
+	c, err := checkout.Open(*dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(c, args); err != nil {
+		if err != errFailed {
+			log.Println(err)
+		}
+		os.Exit(1)
+	}
+}
+
+func link(c checkout.Checkout, args []string) error {
+	fs := flag.NewFlagSet("link", flag.ExitOnError)
+	p := paymentFlags(fs)
+	method := fs.String("method", "", "payment `method`, e.g. sbp")
+	qrFile := fs.String("qr", "", "write the link as a QR code to the `file`, SVG if it ends with .svg, PNG otherwise")
+	fs.Parse(args)
+
+	payment, err := p.payment()
+	if err != nil {
+		return err
+	}
+	payment.PaymentMethod = *method
+
+	url, err := checkout.RequestContext(context.Background(), c, payment)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(url)
+	if *qrFile == "" {
+		return nil
+	}
+
+	var image []byte
+	if strings.HasSuffix(*qrFile, ".svg") {
+		image, err = qr.SVG(url)
+	} else {
+		image, err = qr.PNG(url, 8)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*qrFile, image, 0o644)
+}
+
+func verify(c checkout.Checkout, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var headers headerFlag
+	fs.Var(&headers, "H", "request `header`, e.g. \"X-Api-Signature-SHA256: ...\" (repeatable)")
+	remote := fs.String("remote", "", "`IP` the webhook came from, checked against the provider's networks")
+	fs.Parse(args)
+
+	body, err := readBody(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	if *remote != "" {
+		if err := checkRemote(c, *remote); err != nil {
+			fmt.Println("FAIL", err)
+			failed = true
+		}
+	}
+
+	// Webhooks are parsed offline: the handler would answer them,
+	// e.g. Telegram pre-checkout queries, or call the provider.
+	parser, ok := c.(checkout.Parser)
+	if !ok {
+		return fmt.Errorf("checkout: %T can't parse webhooks offline", c)
+	}
+
+	payment, err := parser.Parse(webhookRequest(body, headers))
+	if err != nil {
+		fmt.Printf("FAIL webhook rejected: %v\n\n", err)
+		explain(os.Stdout, c, webhookRequest(body, headers), err)
+		return errFailed
+	}
+
+	fmt.Println("OK webhook accepted")
+	if unsigned(c) && *remote == "" {
+		fmt.Println("The provider doesn't sign notifications, use -remote to check the source address.")
+	}
+	if _, ok := payment.V.(yookassa.Refund); ok {
+		fmt.Println("It's a refund event: the webhook looks up the refunded payment, which isn't done offline.")
+	}
+	fmt.Println()
+	printPayment(payment)
+
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+func sign(c checkout.Checkout, args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	fs.Parse(args)
+
+	body, err := readBody(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s, err := signature(c, body)
+	if err != nil {
+		return err
+	}
+
+	if s.secret {
+		fmt.Printf("%s: %s, the secret token of the DSN\n", s.field, s.show(s.expected))
+		return nil
+	}
+	fmt.Printf("%s: %s\n", s.field, s.expected)
+	return nil
+}
+
+func simulate(c checkout.Checkout, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	target := fs.String("url", "", "webhook `URL`, e.g. http://localhost:8080/process")
+	status := fs.String("status", "paid", "payment `status`")
+	fault := fs.String("fault", "", "send a defective webhook: bad_signature, tampered_amount or malformed")
+	p := paymentFlags(fs)
+	fs.Parse(args)
+
+	if *target == "" {
+		return errors.New("checkout: -url is required")
+	}
+
+	payment, err := p.payment()
+	if err != nil {
+		return err
+	}
+	if payment.Status, err = checkout.ParseStatus(*status); err != nil {
+		return err
+	}
+
+	var r *http.Request
+	switch *fault {
+	case "":
+		r, err = checkouttest.Webhook(c, payment)
+	case "bad_signature":
+		r, err = checkouttest.Forge(c, payment, checkouttest.BadSignature)
+	case "tampered_amount":
+		r, err = checkouttest.Forge(c, payment, checkouttest.TamperedAmount)
+	case "malformed":
+		r, err = checkouttest.Forge(c, payment, checkouttest.Malformed)
+	default:
+		return fmt.Errorf("checkout: unknown fault %q", *fault)
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = r.Header.Clone()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	fmt.Println("POST", *target)
+	for name, values := range req.Header {
+		fmt.Printf("%s: %s\n", name, strings.Join(values, ", "))
+	}
+	fmt.Printf("\n%s\n\n%s\n", body, resp.Status)
+	if len(respBody) > 0 {
+		fmt.Printf("%s\n", respBody)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errFailed
+	}
+	return nil
+}
+
+func checkRemote(c checkout.Checkout, remote string) error {
+	n, ok := c.(checkout.Networker)
+	if !ok {
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return err
+	}
+
+	for _, network := range n.Networks() {
+		if network.Contains(addr.Unmap()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside of the provider's networks", addr)
+}
+
+// paymentOptions are flags describing a payment.
+type paymentOptions struct {
+	id, amount, currency string
+	comment, successURL  string
+	metadata             metaFlag
+}
+
+func paymentFlags(fs *flag.FlagSet) *paymentOptions {
+	var p paymentOptions
+	fs.StringVar(&p.id, "id", "", "payment `ID`")
+	fs.StringVar(&p.amount, "amount", "", "payment `amount`, e.g. 100.00")
+	fs.StringVar(&p.currency, "currency", checkout.RUB, "`currency` of the amount")
+	fs.StringVar(&p.comment, "comment", "", "payment `comment`")
+	fs.StringVar(&p.successURL, "success-url", "", "`URL` the payer returns to")
+	fs.Var(&p.metadata, "meta", "metadata `key=value` (repeatable)")
+	return &p
+}
+
+func (p *paymentOptions) payment() (checkout.Payment, error) {
+	if p.id == "" {
+		return checkout.Payment{}, errors.New("checkout: -id is required")
+	}
+
+	amount, err := checkout.ParseMoney(p.amount, p.currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	payment := checkout.Payment{
+		ID:         p.id,
+		Amount:     amount,
+		Comment:    p.comment,
+		SuccessURL: p.successURL,
+	}
+	if len(p.metadata) > 0 {
+		payment.Metadata = checkout.Metadata{}
+		for k, v := range p.metadata {
+			payment.Metadata[k] = v
+		}
+	}
+	return payment, nil
+}
+
+func printPayment(p checkout.Payment) {
+	fmt.Printf("Checkout: %s\n", p.Checkout)
+	fmt.Printf("ID:       %s\n", p.ID)
+	fmt.Printf("Status:   %s\n", p.Status)
+	fmt.Printf("Amount:   %s\n", p.Amount)
+	if !p.Profit.IsZero() {
+		fmt.Printf("Profit:   %s\n", p.Profit)
+	}
+	if !p.PaidAt.IsZero() {
+		fmt.Printf("Paid at:  %s\n", p.PaidAt.Format(time.RFC3339))
+	}
+	if p.Comment != "" {
+		fmt.Printf("Comment:  %s\n", p.Comment)
+	}
+	if len(p.Metadata) > 0 {
+		md, _ := json.Marshal(p.Metadata)
+		fmt.Printf("Metadata: %s\n", md)
+	}
+}
+
+func readBody(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func webhookRequest(body []byte, headers headerFlag) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(bytes.TrimSpace(body)))
+	if isJSON(body) {
+		r.Header.Set("Content-Type", "application/json")
+	} else {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, h := range headers {
+		r.Header.Set(h.name, h.value)
+	}
+	return r
+}
+
+func isJSON(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+}
+
+type header struct{ name, value string }
+
+// headerFlag collects repeated -H flags.
+type headerFlag []header
+
+func (f *headerFlag) String() string { return "" }
+
+func (f *headerFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, want \"Name: value\"", s)
+	}
+	*f = append(*f, header{strings.TrimSpace(name), strings.TrimSpace(value)})
+	return nil
+}
+
+// metaFlag collects repeated -meta flags.
+type metaFlag map[string]string
+
+func (f *metaFlag) String() string { return "" }
+
+func (f *metaFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid metadata %q, want key=value", s)
+	}
+	if *f == nil {
+		*f = metaFlag{}
+	}
+	(*f)[k] = v
+	return nil
+}
@@ -0,0 +1,142 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownCurrency means the currency is not registered.
+var ErrUnknownCurrency = errors.New("checkout: unknown currency")
+
+// Currencies.
+const (
+	RUB = "RUB"
+	UAH = "UAH"
+	USD = "USD"
+	EUR = "EUR"
+	KZT = "KZT"
+	BYN = "BYN"
+	UZS = "UZS"
+	GBP = "GBP"
+	CNY = "CNY"
+	TRY = "TRY"
+	AZN = "AZN"
+	GEL = "GEL"
+
+	BTC  = "BTC"
+	ETH  = "ETH"
+	LTC  = "LTC"
+	USDT = "USDT"
+	TON  = "TON"
+	TRX  = "TRX"
+
+	// XTR is Telegram Stars, sold for whole stars only.
+	XTR = "XTR"
+)
+
+// Currency describes a currency known to the module.
+type Currency struct {
+	Code       string // ISO 4217 alphabetic code or a ticker, e.g. "RUB"
+	Numeric    string // ISO 4217 numeric code, e.g. "643", empty for crypto
+	MinorUnits int32  // decimal places of the minor unit, e.g. 2 for kopecks
+	Symbol     string
+	Crypto     bool
+}
+
+var currencies = struct {
+	sync.RWMutex
+	byCode    map[string]Currency
+	byNumeric map[string]Currency
+}{
+	byCode:    make(map[string]Currency),
+	byNumeric: make(map[string]Currency),
+}
+
+func init() {
+	for _, c := range []Currency{
+		{Code: RUB, Numeric: "643", MinorUnits: 2, Symbol: "₽"},
+		{Code: UAH, Numeric: "980", MinorUnits: 2, Symbol: "₴"},
+		{Code: USD, Numeric: "840", MinorUnits: 2, Symbol: "$"},
+		{Code: EUR, Numeric: "978", MinorUnits: 2, Symbol: "€"},
+		{Code: KZT, Numeric: "398", MinorUnits: 2, Symbol: "₸"},
+		{Code: BYN, Numeric: "933", MinorUnits: 2, Symbol: "Br"},
+		{Code: UZS, Numeric: "860", MinorUnits: 2, Symbol: "сўм"},
+		{Code: GBP, Numeric: "826", MinorUnits: 2, Symbol: "£"},
+		{Code: CNY, Numeric: "156", MinorUnits: 2, Symbol: "¥"},
+		{Code: TRY, Numeric: "949", MinorUnits: 2, Symbol: "₺"},
+		{Code: AZN, Numeric: "944", MinorUnits: 2, Symbol: "₼"},
+		{Code: GEL, Numeric: "981", MinorUnits: 2, Symbol: "₾"},
+
+		{Code: BTC, MinorUnits: 8, Symbol: "₿", Crypto: true},
+		{Code: ETH, MinorUnits: 8, Symbol: "Ξ", Crypto: true},
+		{Code: LTC, MinorUnits: 8, Symbol: "Ł", Crypto: true},
+		{Code: USDT, MinorUnits: 2, Symbol: "₮", Crypto: true},
+		{Code: TON, MinorUnits: 9, Crypto: true},
+		{Code: TRX, MinorUnits: 6, Crypto: true},
+
+		{Code: XTR, MinorUnits: 0, Symbol: "⭐"},
+	} {
+		RegisterCurrency(c)
+	}
+}
+
+// RegisterCurrency adds the currency to the registry,
+// replacing the one with the same code.
+func RegisterCurrency(c Currency) {
+	c.Code = strings.ToUpper(c.Code)
+
+	currencies.Lock()
+	defer currencies.Unlock()
+
+	currencies.byCode[c.Code] = c
+	if c.Numeric != "" {
+		currencies.byNumeric[c.Numeric] = c
+	}
+}
+
+// LookupCurrency returns the registered currency by its alphabetic
+// or numeric code, e.g. "RUB" or "643".
+func LookupCurrency(code string) (Currency, bool) {
+	currencies.RLock()
+	defer currencies.RUnlock()
+
+	if c, ok := currencies.byCode[strings.ToUpper(code)]; ok {
+		return c, true
+	}
+	c, ok := currencies.byNumeric[code]
+	return c, ok
+}
+
+// ParseCurrency is like LookupCurrency, but returns ErrUnknownCurrency
+// for unregistered codes.
+func ParseCurrency(code string) (Currency, error) {
+	c, ok := LookupCurrency(code)
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c, nil
+}
+
+// Currencies returns codes of all registered currencies in alphabetical order.
+func Currencies() []string {
+	currencies.RLock()
+	defer currencies.RUnlock()
+
+	codes := make([]string, 0, len(currencies.byCode))
+	for code := range currencies.byCode {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// minorUnits returns decimal places of the currency, two if it's unknown.
+func minorUnits(code string) int32 {
+	if c, ok := LookupCurrency(code); ok {
+		return c.MinorUnits
+	}
+	return 2
+}
@@ -0,0 +1,128 @@
+package checkout
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DedupStore remembers webhook events which have been already processed.
+type DedupStore interface {
+	// Add marks the key as seen. It reports false if the key has been
+	// already seen and hasn't expired yet.
+	Add(ctx context.Context, key string) (bool, error)
+	// Remove forgets the key, so that the event can be processed again.
+	Remove(ctx context.Context, key string) error
+}
+
+// DedupKey returns the key identifying the payment's event: the checkout,
+// the payment ID and its status.
+func DedupKey(p Payment) string {
+	return p.Checkout + ":" + p.ID + ":" + p.Status.String()
+}
+
+// Dedup wraps the callback so that it's called once per event. Repeated
+// events are acknowledged as successful, so every provider still gets
+// its usual response. If the callback fails, the event is forgotten
+// to be processed on the next retry.
+func Dedup(store DedupStore, callback ContextCallback) ContextCallback {
+	return func(ctx context.Context, p Payment) error {
+		key := DedupKey(p)
+
+		ok, err := store.Add(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		if err := callback(ctx, p); err != nil {
+			store.Remove(ctx, key)
+			return err
+		}
+		return nil
+	}
+}
+
+// DedupWebhook is a shorthand for the checkout's webhook with
+// the callback wrapped by Dedup.
+func DedupWebhook(c Checkout, store DedupStore, callback ContextCallback) http.Handler {
+	return WebhookContext(c, Dedup(store, callback))
+}
+
+// MemoryDedup is an in-memory DedupStore. Keys expire after TTL,
+// or never if it's zero.
+type MemoryDedup struct {
+	TTL time.Duration
+
+	mu     sync.Mutex
+	keys   map[string]time.Time
+	purged time.Time
+}
+
+// NewMemoryDedup returns a MemoryDedup with the given TTL.
+func NewMemoryDedup(ttl time.Duration) *MemoryDedup {
+	return &MemoryDedup{TTL: ttl}
+}
+
+// Add implements DedupStore.
+func (d *MemoryDedup) Add(_ context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.purge(now)
+
+	if exp, ok := d.keys[key]; ok && (exp.IsZero() || now.Before(exp)) {
+		return false, nil
+	}
+
+	d.set(key, d.expiry(now))
+	return true, nil
+}
+
+// Remove implements DedupStore.
+func (d *MemoryDedup) Remove(_ context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.keys, key)
+	return nil
+}
+
+// Len returns the number of keys stored, including expired ones
+// not yet purged.
+func (d *MemoryDedup) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.keys)
+}
+
+func (d *MemoryDedup) set(key string, exp time.Time) {
+	if d.keys == nil {
+		d.keys = make(map[string]time.Time)
+	}
+	d.keys[key] = exp
+}
+
+func (d *MemoryDedup) expiry(now time.Time) time.Time {
+	if d.TTL <= 0 {
+		return time.Time{}
+	}
+	return now.Add(d.TTL)
+}
+
+// purge removes expired keys, at most once per TTL.
+func (d *MemoryDedup) purge(now time.Time) {
+	if d.TTL <= 0 || now.Sub(d.purged) < d.TTL {
+		return
+	}
+	for k, exp := range d.keys {
+		if !exp.IsZero() && !now.Before(exp) {
+			delete(d.keys, k)
+		}
+	}
+	d.purged = now
+}
@@ -0,0 +1,168 @@
+package checkout
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileDedup is a DedupStore persisted in a local append-only file,
+// so that processed events survive restarts. The file is compacted
+// every time it's opened.
+type FileDedup struct {
+	mem *MemoryDedup
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFileDedup opens or creates a FileDedup at the given path.
+// Keys expire after ttl, or never if it's zero.
+func OpenFileDedup(path string, ttl time.Duration) (*FileDedup, error) {
+	mem := NewMemoryDedup(ttl)
+	if err := mem.load(path); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the file with alive keys only.
+	tmp := path + ".tmp"
+	if err := mem.dump(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileDedup{mem: mem, f: f}, nil
+}
+
+// Add implements DedupStore.
+func (d *FileDedup) Add(ctx context.Context, key string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ok, err := d.mem.Add(ctx, key)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	d.mem.mu.Lock()
+	exp := d.mem.keys[key]
+	d.mem.mu.Unlock()
+
+	if err := d.write(fmt.Sprintf("+ %d %s\n", unixNano(exp), strconv.Quote(key))); err != nil {
+		d.mem.Remove(ctx, key)
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove implements DedupStore.
+func (d *FileDedup) Remove(ctx context.Context, key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.mem.Remove(ctx, key)
+	return d.write("- 0 " + strconv.Quote(key) + "\n")
+}
+
+// Close closes the underlying file.
+func (d *FileDedup) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.f.Close()
+}
+
+func (d *FileDedup) write(line string) error {
+	if _, err := d.f.WriteString(line); err != nil {
+		return err
+	}
+	return d.f.Sync()
+}
+
+func (d *MemoryDedup) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		key, err := strconv.Unquote(parts[2])
+		if err != nil {
+			continue
+		}
+
+		switch parts[0] {
+		case "+":
+			n, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			exp := time.Time{}
+			if n > 0 {
+				exp = time.Unix(0, n)
+			}
+			if exp.IsZero() || now.Before(exp) {
+				d.set(key, exp)
+			}
+		case "-":
+			delete(d.keys, key)
+		}
+	}
+
+	return s.Err()
+}
+
+func (d *MemoryDedup) dump(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for key, exp := range d.keys {
+		fmt.Fprintf(w, "+ %d %s\n", unixNano(exp), strconv.Quote(key))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -1,10 +1,10 @@
 package enotio
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,6 +20,7 @@ type Checkout struct {
 	MerchantID string
 	APIKey1    string
 	APIKey2    string
+	Logger     checkout.Logger
 }
 
 func (c Checkout) encodeMetadata(md checkout.Metadata) string {
@@ -39,16 +40,44 @@ func (c Checkout) decodeMetadata(s string) checkout.Metadata {
 	return md
 }
 
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "enotio",
+		Metadata:   true,
+		Profit:     true,
+		Currencies: []string{checkout.RUB, checkout.UAH, checkout.USD, checkout.EUR},
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
+}
+
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(_ context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
 	params := url.Values{}
 	params.Set("m", c.MerchantID)
 	params.Set("o", payment.ID)
-	params.Set("oa", payment.Amount)
 	params.Set("cf", c.encodeMetadata(payment.Metadata))
 
+	amount := payment.Amount.Format()
+	params.Set("oa", amount)
+	params.Set("cr", payment.Amount.Currency)
+
 	a := strings.Join([]string{
 		c.MerchantID,
-		payment.Amount,
+		amount,
 		c.APIKey1,
 		payment.ID,
 	}, ":")
@@ -59,47 +88,75 @@ func (c Checkout) Request(payment checkout.Payment) (string, error) {
 }
 
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			log.Println("checkout/enotio:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
 
-		a := strings.Join([]string{
-			c.MerchantID,
-			r.FormValue("amount"),
-			c.APIKey2,
-			r.FormValue("merchant_id"),
-		}, ":")
-
-		hash := md5.Sum([]byte(a))
-		if r.FormValue("sign_2") != hex.EncodeToString(hash[:]) {
-			log.Println("checkout/enotio: bad signature")
-			w.WriteHeader(http.StatusForbidden)
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payment, err := c.Parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, "enotio", err)
 			return
 		}
 
-		custom, _ := url.QueryUnescape(r.FormValue("custom_field"))
-		metadata := c.decodeMetadata(custom)
-
-		payment := checkout.Payment{
-			Checkout: "enotio",
-			ID:       r.FormValue("merchant_id"),
-			Currency: r.FormValue("currency"),
-			Amount:   r.FormValue("amount"),
-			Metadata: metadata,
-			Status:   checkout.StatusPaid,
-			Profit:   r.FormValue("credited"),
-			PaidAt:   time.Now(),
-		}
-
-		if err := callback(payment); err != nil {
-			log.Println("checkout/enotio:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "enotio", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 	})
 }
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	return r.FormValue("sign_2") != "" && r.FormValue("merchant") == c.MerchantID
+}
+
+// Signature returns the expected sign_2 of the notification form.
+func (c Checkout) Signature(form url.Values) string {
+	a := strings.Join([]string{
+		c.MerchantID,
+		form.Get("amount"),
+		c.APIKey2,
+		form.Get("merchant_id"),
+	}, ":")
+
+	hash := md5.Sum([]byte(a))
+	return hex.EncodeToString(hash[:])
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	if err := r.ParseForm(); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if r.FormValue("sign_2") != c.Signature(r.Form) {
+		return checkout.Payment{}, checkout.ErrBadSignature
+	}
+
+	amount, err := checkout.ParseMoney(r.FormValue("amount"), r.FormValue("currency"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	profit, err := checkout.ParseMoney(r.FormValue("credited"), r.FormValue("currency"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	custom, _ := url.QueryUnescape(r.FormValue("custom_field"))
+	metadata := c.decodeMetadata(custom)
+
+	return checkout.Payment{
+		Checkout: "enotio",
+		ID:       r.FormValue("merchant_id"),
+		Amount:   amount,
+		Metadata: metadata,
+		Status:   checkout.StatusPaid,
+		Profit:   profit,
+		PaidAt:   time.Now(),
+	}, nil
+}
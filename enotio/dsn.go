@@ -0,0 +1,21 @@
+package enotio
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("enotio", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: enotio://merchant:key1@?key2=...
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		MerchantID: cfg.User,
+		APIKey1:    cfg.Password,
+		APIKey2:    cfg.Get("key2"),
+	}
+	if err := cfg.Require("merchant", c.MerchantID, "key1", c.APIKey1, "key2", c.APIKey2); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,95 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrBadSignature means a webhook request is not signed by the provider.
+	ErrBadSignature = errors.New("checkout: bad signature")
+	// ErrMalformedPayload means a webhook request can't be decoded.
+	ErrMalformedPayload = errors.New("checkout: malformed payload")
+	// ErrPaymentNotFound means the provider doesn't know the payment.
+	ErrPaymentNotFound = errors.New("checkout: payment not found")
+)
+
+// ProviderError is an error returned by a provider's API.
+type ProviderError struct {
+	Checkout   string // provider name, e.g. "yookassa"
+	StatusCode int    // HTTP status code
+	Code       string // provider specific error code
+	Message    string
+
+	// RetryAfter is the delay asked by the provider with the Retry-After
+	// header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("checkout/%s: (%d) %s", e.Checkout, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("checkout/%s: %s (%s)", e.Checkout, e.Code, e.Message)
+}
+
+// Is reports a 404 response as ErrPaymentNotFound.
+func (e *ProviderError) Is(target error) bool {
+	return target == ErrPaymentNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Temporary reports whether err is a transient failure worth another
+// attempt: a timeout, a failed or dropped connection, or a 5xx or 429
+// provider response. A canceled context is never temporary.
+func Temporary(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.StatusCode >= http.StatusInternalServerError ||
+			perr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	var oerr *net.OpError
+	return errors.As(err, &oerr) && oerr.Op == "dial"
+}
+
+// WebhookError logs err and responds with the matching HTTP status code:
+// 403 for ErrBadSignature, 400 for ErrMalformedPayload and 500 otherwise.
+func WebhookError(w http.ResponseWriter, r *http.Request, l Logger, checkout string, err error) {
+	if l == nil {
+		l = DefaultLogger
+	}
+
+	switch {
+	case errors.Is(err, ErrBadSignature):
+		l.Warn("checkout: webhook rejected", "checkout", checkout, "remote", r.RemoteAddr, "error", err)
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, ErrMalformedPayload):
+		l.Warn("checkout: webhook rejected", "checkout", checkout, "remote", r.RemoteAddr, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		l.Error("checkout: webhook failed", "checkout", checkout, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,336 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable means every checkout of a Failover has its circuit open.
+var ErrUnavailable = errors.New("checkout: no checkout available")
+
+// CircuitState is a state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests until the cooldown passes.
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe request through.
+	CircuitHalfOpen
+)
+
+var circuitStates = [...]string{"closed", "open", "half-open"}
+
+func (s CircuitState) String() string {
+	if s < 0 || int(s) >= len(circuitStates) {
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+	return circuitStates[s]
+}
+
+// Breaker is a circuit breaker. It opens after Threshold consecutive
+// failures and half-opens after Cooldown to let a probe through.
+// The zero value opens after 5 failures for 30 seconds.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow reports whether a request may be made now. A request allowed
+// by Allow must be reported with Success, Failure or Release.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown() {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success reports a successful request, closing the circuit.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure reports a failed request. It reports whether the circuit
+// has been opened by this failure.
+func (b *Breaker) Failure() (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold() {
+		opened = b.state != CircuitOpen
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+	return opened
+}
+
+// Release reports a request that tells nothing about the health,
+// e.g. canceled by the caller, letting another probe through.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state of the circuit.
+func (b *Breaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown() {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold <= 0 {
+		return 5
+	}
+	return b.Threshold
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return b.Cooldown
+}
+
+// CheckoutStats is a snapshot of a checkout's health in a Failover.
+type CheckoutStats struct {
+	Name     string
+	State    CircuitState
+	Requests int64
+	Failures int64
+	// Latency is a moving average of the request duration.
+	Latency   time.Duration
+	LastError string
+	LastFail  time.Time
+}
+
+// ErrorRate returns the share of failed requests.
+func (s CheckoutStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Requests)
+}
+
+// Failover is a Checkout requesting payments from the first available
+// of several checkouts, in the order of registration. Every checkout has
+// its own Breaker, so the one failing to respond is skipped for a while.
+// Webhooks are routed to the checkouts the same way as by Mux.
+//
+// Only temporary failures, see Temporary, open circuits, and only they
+// and ErrUnavailable make requests fall through to the next checkout.
+// Other errors, e.g. a rejected payment, are returned right away.
+//
+// Example:
+//
+//	f := checkout.NewFailover()
+//	f.Handle("yookassa", yoo)
+//	f.Handle("paymaster", paymaster)
+//
+//	link, err := f.Link(ctx, payment) // link.Checkout is the one used
+//
+// A Failover must be configured before it's used.
+type Failover struct {
+	// Threshold and Cooldown configure breakers of the checkouts
+	// registered afterwards, see Breaker.
+	Threshold int
+	Cooldown  time.Duration
+
+	// Logger is used to report circuits opening and closing.
+	Logger Logger
+
+	names   []string
+	members map[string]*member
+}
+
+type member struct {
+	checkout Checkout
+	breaker  *Breaker
+
+	mu    sync.Mutex
+	stats CheckoutStats
+}
+
+// NewFailover returns an empty Failover.
+func NewFailover() *Failover {
+	return &Failover{members: make(map[string]*member)}
+}
+
+// Handle registers the checkout under the given name.
+func (f *Failover) Handle(name string, c Checkout) {
+	if _, ok := f.members[name]; !ok {
+		f.names = append(f.names, name)
+	}
+	f.members[name] = &member{
+		checkout: c,
+		breaker:  &Breaker{Threshold: f.Threshold, Cooldown: f.Cooldown},
+		stats:    CheckoutStats{Name: name},
+	}
+}
+
+// Checkout returns the checkout registered under the given name.
+func (f *Failover) Checkout(name string) (Checkout, bool) {
+	m, ok := f.members[name]
+	if !ok {
+		return nil, false
+	}
+	return m.checkout, true
+}
+
+// Stats returns the current stats of the checkouts in the order
+// of registration.
+func (f *Failover) Stats() []CheckoutStats {
+	stats := make([]CheckoutStats, 0, len(f.names))
+	for _, name := range f.names {
+		m := f.members[name]
+		m.mu.Lock()
+		s := m.stats
+		m.mu.Unlock()
+
+		s.State = m.breaker.State()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Link builds the payment link with the first checkout succeeding.
+func (f *Failover) Link(ctx context.Context, p Payment) (Link, error) {
+	var lastErr error
+	for _, name := range f.names {
+		m := f.members[name]
+
+		// Payments the checkout can't accept don't tell about its health.
+		if v, ok := Unwrap(m.checkout).(Validator); ok {
+			if err := v.Validate(p); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		if !m.breaker.Allow() {
+			continue
+		}
+
+		start := time.Now()
+		url, err := RequestContext(ctx, m.checkout, p)
+		if err != nil && ctx.Err() != nil {
+			// A canceled request doesn't tell about the checkout's health.
+			m.breaker.Release()
+			return Link{}, err
+		}
+		f.report(name, m, time.Since(start), err)
+
+		if err == nil {
+			return Link{Checkout: name, URL: url}, nil
+		}
+		err = fmt.Errorf("checkout/%s: %w", name, err)
+		if !Temporary(err) && !errors.Is(err, ErrUnavailable) {
+			return Link{}, err
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return Link{}, ErrUnavailable
+	}
+	return Link{}, lastErr
+}
+
+func (f *Failover) report(name string, m *member, d time.Duration, err error) {
+	failed := Temporary(err)
+
+	m.mu.Lock()
+	m.stats.Requests++
+	if m.stats.Latency == 0 {
+		m.stats.Latency = d
+	} else {
+		m.stats.Latency += (d - m.stats.Latency) / 5
+	}
+	if failed {
+		m.stats.Failures++
+		m.stats.LastError = err.Error()
+		m.stats.LastFail = time.Now()
+	}
+	m.mu.Unlock()
+
+	logger := f.Logger
+	if logger == nil {
+		logger = DefaultLogger
+	}
+
+	if !failed {
+		if m.breaker.State() != CircuitClosed {
+			logger.Info("checkout: circuit closed", "checkout", name)
+		}
+		m.breaker.Success()
+		return
+	}
+	if m.breaker.Failure() {
+		logger.Warn("checkout: circuit opened", "checkout", name, "error", err)
+	}
+}
+
+func (f *Failover) Request(p Payment) (string, error) {
+	return f.RequestContext(context.Background(), p)
+}
+
+// RequestContext implements ContextCheckout.
+func (f *Failover) RequestContext(ctx context.Context, p Payment) (string, error) {
+	link, err := f.Link(ctx, p)
+	return link.URL, err
+}
+
+func (f *Failover) Webhook(callback Callback) http.Handler {
+	return f.WebhookContext(WithoutContext(callback))
+}
+
+// WebhookContext implements ContextCheckout. The returned handler is
+// a Mux of the checkouts, so Payment.Checkout is set to the name of
+// the checkout the webhook came from.
+func (f *Failover) WebhookContext(callback ContextCallback) http.Handler {
+	mux := NewMux(callback)
+	mux.Logger = f.Logger
+	for _, name := range f.names {
+		mux.Handle(name, f.members[name].checkout)
+	}
+	return mux
+}
@@ -0,0 +1,211 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var (
+	// ErrForbiddenIP means a webhook request came from an address
+	// the provider doesn't send notifications from.
+	ErrForbiddenIP = errors.New("checkout: forbidden ip")
+	// ErrNoNetworks means there are no networks to allow requests from.
+	ErrNoNetworks = errors.New("checkout: no networks to allow")
+)
+
+// Networker is implemented by checkouts publishing the networks
+// their webhooks are sent from.
+type Networker interface {
+	Networks() []netip.Prefix
+}
+
+// ParseNetworks parses CIDR prefixes and single addresses,
+// e.g. "185.71.76.0/27" or "77.75.156.11".
+func ParseNetworks(s ...string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(s))
+	for _, v := range s {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// MustParseNetworks is like ParseNetworks but panics on invalid input.
+func MustParseNetworks(s ...string) []netip.Prefix {
+	networks, err := ParseNetworks(s...)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+// IPFilter rejects webhook requests coming from outside the allowed
+// networks with 403.
+//
+// Behind reverse proxies listed in TrustedProxies, the client address
+// is taken from X-Forwarded-For, skipping trusted hops from the right,
+// or from X-Real-IP. The headers of other peers are ignored.
+type IPFilter struct {
+	// Allowed overrides the networks published by the checkout.
+	Allowed []netip.Prefix
+	// TrustedProxies are networks of reverse proxies in front of the service.
+	TrustedProxies []netip.Prefix
+	// Logger is used to report rejected requests.
+	Logger Logger
+}
+
+// ClientIP returns the address the request came from.
+func (f IPFilter) ClientIP(r *http.Request) (netip.Addr, error) {
+	addr, err := parseAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !inNetworks(f.TrustedProxies, addr) {
+		return addr, nil
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	if len(hops) == 0 {
+		if real := r.Header.Get("X-Real-IP"); real != "" {
+			return parseAddr(real)
+		}
+		return addr, nil
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if addr, err = parseAddr(hops[i]); err != nil {
+			return netip.Addr{}, err
+		}
+		if !inNetworks(f.TrustedProxies, addr) {
+			break
+		}
+	}
+	return addr, nil
+}
+
+// Check returns ErrForbiddenIP unless the request comes from one
+// of the networks. No networks allow no request.
+func (f IPFilter) Check(r *http.Request, networks []netip.Prefix) error {
+	addr, err := f.ClientIP(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenIP, err)
+	}
+	if !inNetworks(networks, addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenIP, addr)
+	}
+	return nil
+}
+
+// Wrap returns a handler serving only requests from the allowed networks,
+// rejecting every request if there are none.
+func (f IPFilter) Wrap(h http.Handler) http.Handler {
+	return f.wrap(h, "", f.Allowed)
+}
+
+func (f IPFilter) wrap(h http.Handler, checkout string, networks []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := f.Check(r, networks); err != nil {
+			logger := f.Logger
+			if logger == nil {
+				logger = DefaultLogger
+			}
+			logger.Warn("checkout: webhook rejected", "checkout", checkout, "remote", r.RemoteAddr, "error", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// FilterIPs wraps the checkout so that its webhooks are only served for
+// requests coming from the networks it publishes, or f.Allowed if set.
+// It returns ErrNoNetworks if there are neither. The result can be
+// registered in a Mux, Router or Failover.
+//
+// The wrapper is a ContextCheckout and a Networker of the allowed networks
+// only. Other interfaces of the checkout, e.g. Refunder, are probed on
+// Unwrap of the wrapper.
+func FilterIPs(c Checkout, f IPFilter) (Checkout, error) {
+	networks := f.Allowed
+	if len(networks) == 0 {
+		if n, ok := c.(Networker); ok {
+			networks = n.Networks()
+		}
+	}
+	if len(networks) == 0 {
+		return nil, fmt.Errorf("%w: %T", ErrNoNetworks, c)
+	}
+	return &ipFiltered{Checkout: c, filter: f, networks: networks}, nil
+}
+
+type ipFiltered struct {
+	Checkout
+	filter   IPFilter
+	networks []netip.Prefix
+}
+
+func (c *ipFiltered) RequestContext(ctx context.Context, p Payment) (string, error) {
+	return RequestContext(ctx, c.Checkout, p)
+}
+
+func (c *ipFiltered) Webhook(callback Callback) http.Handler {
+	return c.WebhookContext(WithoutContext(callback))
+}
+
+func (c *ipFiltered) WebhookContext(callback ContextCallback) http.Handler {
+	name := fmt.Sprintf("%T", c.Checkout)
+	if v, ok := Unwrap(c.Checkout).(Validator); ok {
+		name = v.Capabilities().Checkout
+	}
+	return c.filter.wrap(WebhookContext(c.Checkout, callback), name, c.networks)
+}
+
+// Networks implements Networker.
+func (c *ipFiltered) Networks() []netip.Prefix {
+	return c.networks
+}
+
+// Unwrap returns the filtered checkout.
+func (c *ipFiltered) Unwrap() Checkout {
+	return c.Checkout
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+func inNetworks(networks []netip.Prefix, addr netip.Addr) bool {
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
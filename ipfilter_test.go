@@ -0,0 +1,93 @@
+package checkout_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/checkouttest"
+	"go.massbots.xyz/checkout/enotio"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yoomoney"
+)
+
+func TestFilterIPs(t *testing.T) {
+	co := yookassa.Checkout{ShopID: "1", APIKey: "key", Logger: &recordLogger{}}
+
+	filtered, err := checkout.FilterIPs(co, checkout.IPFilter{Logger: &recordLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the wrapped checkout is a Refunder.
+	if _, ok := filtered.(checkout.Refunder); ok {
+		t.Error("the wrapper implements Refunder")
+	}
+	if _, ok := checkout.Unwrap(filtered).(checkout.Refunder); !ok {
+		t.Error("Unwrap isn't a Refunder")
+	}
+	if checkout.Unwrap(co) != checkout.Checkout(co) {
+		t.Error("Unwrap of an unwrapped checkout isn't the checkout itself")
+	}
+
+	tests := []struct {
+		remote string
+		code   int
+	}{
+		{"185.71.76.1:443", http.StatusOK},
+		{"203.0.113.7:443", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r, err := checkouttest.Webhook(co, checkout.Payment{
+			ID:     "42",
+			Amount: checkout.MustParseMoney("100.00", checkout.RUB),
+			Status: checkout.StatusPaid,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = tt.remote
+
+		called := false
+		w := httptest.NewRecorder()
+		checkout.WebhookContext(filtered, func(context.Context, checkout.Payment) error {
+			called = true
+			return nil
+		}).ServeHTTP(w, r)
+
+		if w.Code != tt.code || called != (tt.code == http.StatusOK) {
+			t.Errorf("webhook from %s answered with %d, callback called: %v", tt.remote, w.Code, called)
+		}
+	}
+}
+
+// unlisted is a checkout publishing no networks.
+type unlisted struct{}
+
+func (unlisted) Request(checkout.Payment) (string, error) { return "", nil }
+func (unlisted) Webhook(checkout.Callback) http.Handler   { return http.NotFoundHandler() }
+
+func TestFilterIPsWithoutNetworks(t *testing.T) {
+	co := unlisted{}
+
+	for _, c := range []checkout.Checkout{
+		co,
+		paymaster.Checkout{MerchantID: "1", Token: "token"},
+		yoomoney.Checkout{Receiver: "4100", SecretKey: "key"},
+		enotio.Checkout{MerchantID: "1", APIKey1: "key1", APIKey2: "key2"},
+	} {
+		if _, err := checkout.FilterIPs(c, checkout.IPFilter{}); !errors.Is(err, checkout.ErrNoNetworks) {
+			t.Errorf("FilterIPs(%T) = %v, want ErrNoNetworks", c, err)
+		}
+	}
+
+	allowed := checkout.IPFilter{Allowed: checkout.MustParseNetworks("203.0.113.0/24")}
+	if _, err := checkout.FilterIPs(co, allowed); err != nil {
+		t.Errorf("FilterIPs with allowed networks = %v", err)
+	}
+}
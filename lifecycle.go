@@ -0,0 +1,206 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTransition means a payment can't move to the reported status
+// from the one it has already reached.
+var ErrInvalidTransition = errors.New("checkout: invalid status transition")
+
+type (
+	// Transition is a change of a payment's status.
+	Transition struct {
+		From Status    `json:"from"`
+		To   Status    `json:"to"`
+		At   time.Time `json:"at"`
+	}
+
+	// StateStore keeps the history of status transitions per payment.
+	StateStore interface {
+		// History returns the transitions of the key in chronological order.
+		History(ctx context.Context, key string) ([]Transition, error)
+		// Append adds a transition to the key's history.
+		Append(ctx context.Context, key string, t Transition) error
+	}
+)
+
+// transitions lists the statuses reachable from every status.
+// A payment with no history may take any known status.
+var transitions = map[Status][]Status{
+	StatusWaiting: {
+		StatusWaitingForCapture, StatusPaid,
+		StatusExpired, StatusRejected, StatusCanceled,
+	},
+	StatusWaitingForCapture: {
+		StatusPaid, StatusExpired, StatusRejected, StatusCanceled,
+	},
+	StatusPaid: {
+		StatusPartiallyRefunded, StatusRefunded,
+	},
+	// Every further partial refund reports the same status.
+	StatusPartiallyRefunded: {
+		StatusPartiallyRefunded, StatusRefunded,
+	},
+}
+
+// CanTransition reports whether a payment may move from one status to
+// another, e.g. waiting to paid and paid to refunded, but never paid
+// to waiting. StatusUnknown as from means no status has been seen yet.
+func CanTransition(from, to Status) bool {
+	if to == StatusUnknown {
+		return false
+	}
+	if from == StatusUnknown {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateMachine tracks the last known status of every payment and
+// rejects events arriving out of order.
+type StateMachine struct {
+	Store StateStore
+	// Logger is used to report ignored events.
+	Logger Logger
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewStateMachine returns a StateMachine backed by the store.
+func NewStateMachine(store StateStore) *StateMachine {
+	return &StateMachine{Store: store}
+}
+
+// StateKey returns the key a payment's history is stored under.
+func StateKey(checkout, id string) string {
+	return checkout + ":" + id
+}
+
+// History returns the status transitions of the payment.
+func (m *StateMachine) History(ctx context.Context, checkout, id string) ([]Transition, error) {
+	return m.Store.History(ctx, StateKey(checkout, id))
+}
+
+// Status returns the last known status of the payment,
+// or StatusUnknown if there is none.
+func (m *StateMachine) Status(ctx context.Context, checkout, id string) (Status, error) {
+	h, err := m.History(ctx, checkout, id)
+	if err != nil || len(h) == 0 {
+		return StatusUnknown, err
+	}
+	return h[len(h)-1].To, nil
+}
+
+// Advance moves the payment to its status by calling fn and recording
+// the transition if fn succeeds. It returns ErrInvalidTransition without
+// calling fn if the transition is not allowed.
+func (m *StateMachine) Advance(ctx context.Context, p Payment, fn func() error) error {
+	key := StateKey(p.Checkout, p.ID)
+
+	unlock := m.lock(key)
+	defer unlock()
+
+	from, err := m.Status(ctx, p.Checkout, p.ID)
+	if err != nil {
+		return err
+	}
+	if !CanTransition(from, p.Status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, p.Status)
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return m.Store.Append(ctx, key, Transition{
+		From: from,
+		To:   p.Status,
+		At:   time.Now(),
+	})
+}
+
+// Callback wraps the callback so that it's only called for legal,
+// newer statuses. Other events are acknowledged and dropped.
+func (m *StateMachine) Callback(callback ContextCallback) ContextCallback {
+	return func(ctx context.Context, p Payment) error {
+		err := m.Advance(ctx, p, func() error {
+			return callback(ctx, p)
+		})
+		if errors.Is(err, ErrInvalidTransition) {
+			logger := m.Logger
+			if logger == nil {
+				logger = DefaultLogger
+			}
+			logger.Warn("checkout: event ignored", "checkout", p.Checkout, "id", p.ID, "error", err)
+			return nil
+		}
+		return err
+	}
+}
+
+func (m *StateMachine) lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		m.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// MemoryStateStore is an in-memory StateStore.
+type MemoryStateStore struct {
+	mu      sync.RWMutex
+	history map[string][]Transition
+}
+
+// NewMemoryStateStore returns an empty MemoryStateStore.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{history: make(map[string][]Transition)}
+}
+
+// History implements StateStore.
+func (s *MemoryStateStore) History(_ context.Context, key string) ([]Transition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Transition(nil), s.history[key]...), nil
+}
+
+// Append implements StateStore.
+func (s *MemoryStateStore) Append(_ context.Context, key string, t Transition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[key] = append(s.history[key], t)
+	return nil
+}
@@ -0,0 +1,143 @@
+package checkout_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to checkout.Status
+		ok       bool
+	}{
+		{checkout.StatusUnknown, checkout.StatusPaid, true},
+		{checkout.StatusUnknown, checkout.StatusRefunded, true},
+		{checkout.StatusUnknown, checkout.StatusUnknown, false},
+		{checkout.StatusWaiting, checkout.StatusPaid, true},
+		{checkout.StatusWaiting, checkout.StatusWaitingForCapture, true},
+		{checkout.StatusWaiting, checkout.StatusExpired, true},
+		{checkout.StatusWaiting, checkout.StatusWaiting, false},
+		{checkout.StatusWaiting, checkout.StatusRefunded, false},
+		{checkout.StatusWaitingForCapture, checkout.StatusPaid, true},
+		{checkout.StatusWaitingForCapture, checkout.StatusCanceled, true},
+		{checkout.StatusWaitingForCapture, checkout.StatusWaiting, false},
+		{checkout.StatusPaid, checkout.StatusPartiallyRefunded, true},
+		{checkout.StatusPaid, checkout.StatusRefunded, true},
+		{checkout.StatusPaid, checkout.StatusWaiting, false},
+		{checkout.StatusPaid, checkout.StatusPaid, false},
+		{checkout.StatusPartiallyRefunded, checkout.StatusPartiallyRefunded, true},
+		{checkout.StatusPartiallyRefunded, checkout.StatusRefunded, true},
+		{checkout.StatusPartiallyRefunded, checkout.StatusPaid, false},
+		{checkout.StatusRefunded, checkout.StatusPartiallyRefunded, false},
+		{checkout.StatusExpired, checkout.StatusPaid, false},
+		{checkout.StatusCanceled, checkout.StatusPaid, false},
+		{checkout.StatusRejected, checkout.StatusWaiting, false},
+	}
+
+	for _, tt := range tests {
+		if got := checkout.CanTransition(tt.from, tt.to); got != tt.ok {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.ok)
+		}
+	}
+}
+
+type recordLogger struct {
+	warnings []string
+}
+
+func (*recordLogger) Debug(string, ...any) {}
+func (*recordLogger) Info(string, ...any)  {}
+func (*recordLogger) Error(string, ...any) {}
+
+func (l *recordLogger) Warn(msg string, _ ...any) {
+	l.warnings = append(l.warnings, msg)
+}
+
+func TestStateMachine(t *testing.T) {
+	ctx := context.Background()
+	logger := &recordLogger{}
+
+	sm := checkout.NewStateMachine(checkout.NewMemoryStateStore())
+	sm.Logger = logger
+
+	var called []checkout.Status
+	callback := sm.Callback(func(_ context.Context, p checkout.Payment) error {
+		called = append(called, p.Status)
+		return nil
+	})
+
+	events := []checkout.Status{
+		checkout.StatusWaiting,
+		checkout.StatusPaid,
+		checkout.StatusWaiting, // late
+		checkout.StatusPartiallyRefunded,
+		checkout.StatusPartiallyRefunded,
+		checkout.StatusPaid, // late
+		checkout.StatusRefunded,
+	}
+	for _, s := range events {
+		p := checkout.Payment{Checkout: "yookassa", ID: "42", Status: s}
+		if err := callback(ctx, p); err != nil {
+			t.Fatalf("callback(%s): %v", s, err)
+		}
+	}
+
+	want := []checkout.Status{
+		checkout.StatusWaiting,
+		checkout.StatusPaid,
+		checkout.StatusPartiallyRefunded,
+		checkout.StatusPartiallyRefunded,
+		checkout.StatusRefunded,
+	}
+	if len(called) != len(want) {
+		t.Fatalf("called back for %v, want %v", called, want)
+	}
+	for i := range want {
+		if called[i] != want[i] {
+			t.Fatalf("called back for %v, want %v", called, want)
+		}
+	}
+	if len(logger.warnings) != 2 {
+		t.Errorf("%d dropped events logged, want 2", len(logger.warnings))
+	}
+
+	status, err := sm.Status(ctx, "yookassa", "42")
+	if err != nil || status != checkout.StatusRefunded {
+		t.Errorf("Status = %s, %v, want refunded", status, err)
+	}
+	history, err := sm.History(ctx, "yookassa", "42")
+	if err != nil || len(history) != len(want) {
+		t.Fatalf("History = %v, %v", history, err)
+	}
+	if history[0].From != checkout.StatusUnknown || history[1].From != checkout.StatusWaiting {
+		t.Errorf("History = %v", history)
+	}
+}
+
+func TestStateMachineFailedCallback(t *testing.T) {
+	ctx := context.Background()
+	sm := checkout.NewStateMachine(checkout.NewMemoryStateStore())
+
+	failure := errors.New("failed")
+	p := checkout.Payment{Checkout: "yookassa", ID: "42", Status: checkout.StatusPaid}
+
+	err := sm.Advance(ctx, p, func() error { return failure })
+	if !errors.Is(err, failure) {
+		t.Fatalf("Advance = %v, want the callback's error", err)
+	}
+	if status, _ := sm.Status(ctx, "yookassa", "42"); status != checkout.StatusUnknown {
+		t.Errorf("Status after a failed callback = %s, want unknown", status)
+	}
+
+	// The provider retries the event.
+	if err := sm.Advance(ctx, p, func() error { return nil }); err != nil {
+		t.Fatalf("Advance of a retried event = %v", err)
+	}
+	err = sm.Advance(ctx, p, func() error { return nil })
+	if !errors.Is(err, checkout.ErrInvalidTransition) {
+		t.Errorf("Advance of a duplicate = %v, want ErrInvalidTransition", err)
+	}
+}
@@ -0,0 +1,45 @@
+package checkout
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is a structured logger. It's satisfied by *slog.Logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// DefaultLogger is used by providers with no Logger set.
+// It writes warnings and errors to the standard logger.
+var DefaultLogger Logger = stdLogger{}
+
+type stdLogger struct{}
+
+func (stdLogger) Debug(string, ...any) {}
+func (stdLogger) Info(string, ...any)  {}
+
+func (l stdLogger) Warn(msg string, args ...any) {
+	l.print(msg, args)
+}
+
+func (l stdLogger) Error(msg string, args ...any) {
+	l.print(msg, args)
+}
+
+func (stdLogger) print(msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	log.Println(b.String())
+}
@@ -0,0 +1,152 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrCurrencyMismatch is returned by Money operations on different currencies.
+var ErrCurrencyMismatch = errors.New("checkout: currency mismatch")
+
+// Money is an exact amount of money in the given currency.
+type Money struct {
+	Value    decimal.Decimal `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+// NewMoney returns a Money of the given value and currency.
+func NewMoney(value decimal.Decimal, currency string) Money {
+	return Money{Value: value, Currency: currency}
+}
+
+// ParseMoney parses a decimal string like "100.10" into a Money.
+// An empty string is parsed as zero.
+func ParseMoney(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Money{Currency: currency}, nil
+	}
+
+	v, err := decimal.NewFromString(strings.Replace(s, ",", ".", 1))
+	if err != nil {
+		return Money{}, fmt.Errorf("checkout: invalid amount %q", s)
+	}
+
+	return Money{Value: v, Currency: currency}, nil
+}
+
+// MustParseMoney is like ParseMoney but panics if s can't be parsed.
+func MustParseMoney(s, currency string) Money {
+	m, err := ParseMoney(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// FromMinor returns a Money from an integer amount of minor units,
+// e.g. kopecks or cents, as defined by the currency.
+func FromMinor(units int64, currency string) Money {
+	return Money{Value: decimal.New(units, -minorUnits(currency)), Currency: currency}
+}
+
+// String returns the formatted amount followed by the currency,
+// e.g. "100.10 RUB".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Format()
+	}
+	return m.Format() + " " + m.Currency
+}
+
+// Format returns the amount with as many decimal places as the currency's
+// minor units, e.g. "100.10" for RUB or "0.00100000" for BTC. Unknown
+// currencies have two decimal places.
+func (m Money) Format() string {
+	return m.StringFixed(minorUnits(m.Currency))
+}
+
+// StringFixed returns the amount rounded to the given number of decimal places,
+// e.g. "100.10" for places = 2.
+func (m Money) StringFixed(places int32) string {
+	return m.Value.StringFixed(places)
+}
+
+// Minor returns the amount as an integer number of minor units,
+// e.g. 10010 for 100.10 RUB.
+func (m Money) Minor() int64 {
+	return m.Value.Shift(minorUnits(m.Currency)).Round(0).IntPart()
+}
+
+// Validate checks that the currency is registered and the amount
+// has no more decimal places than its minor units.
+func (m Money) Validate() error {
+	c, err := ParseCurrency(m.Currency)
+	if err != nil {
+		return err
+	}
+	if !m.Value.Equal(m.Value.Round(c.MinorUnits)) {
+		return fmt.Errorf("checkout: %s has more than %d decimal places", m.Value, c.MinorUnits)
+	}
+	return nil
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Value.IsZero()
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Value.IsPositive()
+}
+
+// IsNegative reports whether the amount is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Value.IsNegative()
+}
+
+// Add returns m + o. Both amounts must be of the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Value: m.Value.Add(o.Value), Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both amounts must be of the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Value: m.Value.Sub(o.Value), Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by the given factor.
+func (m Money) Mul(f decimal.Decimal) Money {
+	return Money{Value: m.Value.Mul(f), Currency: m.Currency}
+}
+
+// Cmp compares m and o, returning -1, 0 or +1 like decimal.Decimal.Cmp.
+// Both amounts must be of the same currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	return m.Value.Cmp(o.Value), nil
+}
+
+// Equal reports whether m and o are of the same currency and value.
+func (m Money) Equal(o Money) bool {
+	return m.Currency == o.Currency && m.Value.Equal(o.Value)
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package checkout_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		s        string
+		currency string
+		want     string
+		err      bool
+	}{
+		{"100.10", checkout.RUB, "100.10 RUB", false},
+		{"100,10", checkout.RUB, "100.10 RUB", false},
+		{" 5 ", checkout.USD, "5.00 USD", false},
+		{"", checkout.RUB, "0.00 RUB", false},
+		{"0.001", checkout.BTC, "0.00100000 BTC", false},
+		{"50", checkout.XTR, "50 XTR", false},
+		{"1e2", "", "100.00", false},
+		{"abc", checkout.RUB, "", true},
+		{"1.2.3", checkout.RUB, "", true},
+	}
+
+	for _, tt := range tests {
+		m, err := checkout.ParseMoney(tt.s, tt.currency)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %s, want error", tt.s, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.s, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("ParseMoney(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMinor(t *testing.T) {
+	tests := []struct {
+		money checkout.Money
+		minor int64
+	}{
+		{checkout.MustParseMoney("100.10", checkout.RUB), 10010},
+		{checkout.MustParseMoney("0.01", checkout.USD), 1},
+		{checkout.MustParseMoney("0.000000001", checkout.TON), 1},
+		{checkout.MustParseMoney("50", checkout.XTR), 50},
+		{checkout.MustParseMoney("0.00100000", checkout.BTC), 100000},
+		{checkout.MustParseMoney("1.005", checkout.RUB), 101},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Minor(); got != tt.minor {
+			t.Errorf("%s.Minor() = %d, want %d", tt.money, got, tt.minor)
+		}
+		if tt.money.Validate() == nil {
+			if back := checkout.FromMinor(tt.minor, tt.money.Currency); !back.Equal(tt.money) {
+				t.Errorf("FromMinor(%d, %s) = %s, want %s", tt.minor, tt.money.Currency, back, tt.money)
+			}
+		}
+	}
+}
+
+func TestMoneyValidate(t *testing.T) {
+	tests := []struct {
+		money checkout.Money
+		ok    bool
+	}{
+		{checkout.MustParseMoney("100.10", checkout.RUB), true},
+		{checkout.MustParseMoney("100.101", checkout.RUB), false},
+		{checkout.MustParseMoney("1.5", checkout.XTR), false},
+		{checkout.MustParseMoney("1", checkout.XTR), true},
+		{checkout.MustParseMoney("1", "XXX"), false},
+		{checkout.MustParseMoney("1", ""), false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.money.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s.Validate() = %v, want ok = %v", tt.money, err, tt.ok)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a := checkout.MustParseMoney("100.10", checkout.RUB)
+	b := checkout.MustParseMoney("0.90", checkout.RUB)
+
+	sum, err := a.Add(b)
+	if err != nil || !sum.Equal(checkout.MustParseMoney("101", checkout.RUB)) {
+		t.Errorf("Add = %s, %v, want 101.00 RUB", sum, err)
+	}
+	diff, err := b.Sub(a)
+	if err != nil || !diff.IsNegative() || diff.Format() != "-99.20" {
+		t.Errorf("Sub = %s, %v, want -99.20 RUB", diff, err)
+	}
+	if cmp, err := a.Cmp(b); err != nil || cmp != 1 {
+		t.Errorf("Cmp = %d, %v, want 1", cmp, err)
+	}
+
+	usd := checkout.MustParseMoney("1", checkout.USD)
+	if _, err := a.Add(usd); !errors.Is(err, checkout.ErrCurrencyMismatch) {
+		t.Errorf("Add of RUB and USD = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := a.Cmp(usd); !errors.Is(err, checkout.ErrCurrencyMismatch) {
+		t.Errorf("Cmp of RUB and USD = %v, want ErrCurrencyMismatch", err)
+	}
+	if a.Equal(checkout.MustParseMoney("100.10", checkout.USD)) {
+		t.Error("amounts of different currencies are equal")
+	}
+}
+
+func TestRefundAmount(t *testing.T) {
+	rub := func(s string) checkout.Money {
+		return checkout.MustParseMoney(s, checkout.RUB)
+	}
+
+	tests := []struct {
+		paid, refunded, amount checkout.Money
+		want                   string
+		err                    error
+	}{
+		{rub("100"), rub("0"), checkout.Money{}, "100.00 RUB", nil},
+		{rub("100"), rub("30"), checkout.Money{}, "70.00 RUB", nil},
+		{rub("100"), rub("30"), rub("20"), "20.00 RUB", nil},
+		{rub("100"), rub("30"), rub("70"), "70.00 RUB", nil},
+		{rub("100"), rub("30"), rub("70.01"), "", checkout.ErrRefundExceeded},
+		{rub("100"), rub("100"), checkout.Money{}, "", checkout.ErrRefundExceeded},
+	}
+
+	for _, tt := range tests {
+		got, err := checkout.RefundAmount(tt.paid, tt.refunded, tt.amount)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("RefundAmount(%s, %s, %s) = %v, want %v", tt.paid, tt.refunded, tt.amount, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("RefundAmount(%s, %s, %s) = %s, %v, want %s", tt.paid, tt.refunded, tt.amount, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package checkout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxSniffSize limits the size of a webhook body buffered for detection.
+const maxSniffSize = 1 << 20
+
+// errTooLarge means the webhook body exceeds maxSniffSize.
+var errTooLarge = errors.New("checkout: webhook body is too large")
+
+// Detector is implemented by checkouts able to recognize their own
+// webhook requests. Detect may consume the request body.
+type Detector interface {
+	Detect(*http.Request) bool
+}
+
+// Mux is an http.Handler dispatching webhooks of several checkouts
+// to a single callback.
+//
+// A request is routed to the checkout whose name matches the first
+// segment of the request path, e.g. "/yookassa". Otherwise, the checkouts
+// implementing Detector are asked in the order of registration.
+//
+// Example:
+//
+//	mux := checkout.NewMux(callback)
+//	mux.Handle("yookassa", yoo)
+//	mux.Handle("payeer", payeer)
+//	http.Handle("/checkout/", http.StripPrefix("/checkout", mux))
+type Mux struct {
+	// Logger is used to report unrouted requests.
+	Logger Logger
+
+	callback ContextCallback
+	names    []string
+	entries  map[string]muxEntry
+}
+
+type muxEntry struct {
+	checkout Checkout
+	handler  http.Handler
+}
+
+// NewMux returns a Mux calling the callback for every registered checkout.
+func NewMux(callback ContextCallback) *Mux {
+	return &Mux{
+		callback: callback,
+		entries:  make(map[string]muxEntry),
+	}
+}
+
+// Handle registers the checkout under the given name. The name is set
+// as Payment.Checkout of every payment passed to the callback.
+func (m *Mux) Handle(name string, c Checkout) {
+	if _, ok := m.entries[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	m.entries[name] = muxEntry{
+		checkout: c,
+		handler: WebhookContext(c, func(ctx context.Context, p Payment) error {
+			p.Checkout = name
+			return m.callback(ctx, p)
+		}),
+	}
+}
+
+// Checkout returns the checkout registered under the given name.
+func (m *Mux) Checkout(name string) (Checkout, bool) {
+	e, ok := m.entries[name]
+	return e.checkout, ok
+}
+
+// Names returns the names of the registered checkouts in the order
+// of registration.
+func (m *Mux) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
+func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := m.route(r)
+	if errors.Is(err, errTooLarge) {
+		logger := m.Logger
+		if logger == nil {
+			logger = DefaultLogger
+		}
+		logger.Warn("checkout: webhook rejected", "path", r.URL.Path, "remote", r.RemoteAddr, "error", err)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		WebhookError(w, r, m.Logger, "mux", err)
+		return
+	}
+	if name == "" {
+		logger := m.Logger
+		if logger == nil {
+			logger = DefaultLogger
+		}
+		logger.Warn("checkout: unrouted webhook", "path", r.URL.Path, "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	m.entries[name].handler.ServeHTTP(w, r)
+}
+
+// Route returns the name of the checkout the request is intended for,
+// or an empty string if there is none.
+func (m *Mux) Route(r *http.Request) string {
+	name, _ := m.route(r)
+	return name
+}
+
+func (m *Mux) route(r *http.Request) (string, error) {
+	segment := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	if _, ok := m.entries[segment]; ok {
+		return segment, nil
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		// One more byte tells an oversized body from one of the limit.
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSniffSize+1))
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		if len(body) > maxSniffSize {
+			return "", errTooLarge
+		}
+	}
+
+	defer func() {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}()
+
+	for _, name := range m.names {
+		d, ok := Unwrap(m.entries[name].checkout).(Detector)
+		if !ok {
+			continue
+		}
+
+		rr := r.Clone(r.Context())
+		rr.Body = io.NopCloser(bytes.NewReader(body))
+		if d.Detect(rr) {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
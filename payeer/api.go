@@ -0,0 +1,143 @@
+package payeer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+const APIURL = "https://payeer.com/ajax/api/api.php"
+
+type (
+	// Order is a merchant order returned by the API.
+	Order struct {
+		ID          string `json:"id"`
+		DateCreate  string `json:"dateCreate"`
+		DatePay     string `json:"datePay"`
+		Status      string `json:"status"`
+		SumIn       string `json:"sumIn"`
+		CurIn       string `json:"curIn"`
+		SumOut      string `json:"sumOut"`
+		CurOut      string `json:"curOut"`
+		Description string `json:"description"`
+	}
+)
+
+var orderStatuses = map[string]checkout.Status{
+	"new":     checkout.StatusWaiting,
+	"process": checkout.StatusWaiting,
+	"execute": checkout.StatusPaid,
+	"success": checkout.StatusPaid,
+	"cancel":  checkout.StatusCanceled,
+	"error":   checkout.StatusRejected,
+}
+
+// Payment implements checkout.Fetcher. Requires Account, APIID and APIPass.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	var result struct {
+		Info *Order `json:"info"`
+	}
+
+	params := url.Values{}
+	params.Set("shopId", c.MerchantID)
+	params.Set("orderId", id)
+
+	if err := c.api(ctx, "shopOrderInfo", params, &result); err != nil {
+		return checkout.Payment{}, err
+	}
+	if result.Info == nil {
+		return checkout.Payment{}, checkout.ErrPaymentNotFound
+	}
+
+	o := *result.Info
+
+	amount, err := checkout.ParseMoney(o.SumIn, o.CurIn)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	profit, err := checkout.ParseMoney(o.SumOut, o.CurOut)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	paidAt, _ := time.ParseInLocation("2006-01-02 15:04:05", o.DatePay, timeLoc)
+
+	return checkout.Payment{
+		Checkout: "payeer",
+		ID:       id,
+		Amount:   amount,
+		Comment:  o.Description,
+		Status:   orderStatuses[o.Status],
+		Profit:   profit,
+		PaidAt:   paidAt.UTC(),
+		V:        o,
+	}, nil
+}
+
+func (c Checkout) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// api calls the API action, decoding the response into v.
+func (c Checkout) api(ctx context.Context, action string, params url.Values, v any) error {
+	params.Set("account", c.Account)
+	params.Set("apiId", c.APIID)
+	params.Set("apiPass", c.APIPass)
+	params.Set("action", action)
+
+	base := c.APIURL
+	if base == "" {
+		base = APIURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"?"+action, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+
+	var maybeError struct {
+		AuthError string   `json:"auth_error"`
+		Errors    []string `json:"errors"`
+	}
+	json.Unmarshal(data, &maybeError)
+
+	if maybeError.AuthError != "" && maybeError.AuthError != "0" {
+		return &checkout.ProviderError{
+			Checkout:   "payeer",
+			StatusCode: resp.StatusCode,
+			Code:       "auth_error",
+			Message:    strings.Join(maybeError.Errors, "; "),
+		}
+	}
+	if len(maybeError.Errors) > 0 {
+		return &checkout.ProviderError{
+			Checkout:   "payeer",
+			StatusCode: resp.StatusCode,
+			Message:    strings.Join(maybeError.Errors, "; "),
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -1,11 +1,13 @@
 package payeer
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"log"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 	"time"
@@ -19,23 +21,74 @@ const BaseURL = "https://payeer.com/merchant/?"
 type Checkout struct {
 	MerchantID string
 	APIKey     string
+	Logger     checkout.Logger
+
+	// Account, APIID and APIPass are credentials of an API user,
+	// needed to query the API.
+	Account string
+	APIID   string
+	APIPass string
+
+	// Client and APIURL default to http.DefaultClient and APIURL.
+	Client *http.Client
+	APIURL string
+}
+
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout: "payeer",
+		Fields:   []string{"Comment"},
+		Currencies: []string{
+			checkout.USD, checkout.RUB, checkout.EUR,
+			checkout.BTC, checkout.ETH, checkout.LTC, checkout.USDT, checkout.TRX,
+		},
+	}
+}
+
+// Validate implements checkout.Validator. Payeer takes amounts with
+// exactly two decimal places, crypto currencies included.
+func (c Checkout) Validate(p checkout.Payment) error {
+	if err := c.Capabilities().Validate(p); err != nil {
+		return err
+	}
+	if !p.Amount.Value.Equal(p.Amount.Value.Round(2)) {
+		return &checkout.ValidationError{
+			Checkout: "payeer",
+			Field:    "Amount",
+			Reason:   "has more than 2 decimal places",
+		}
+	}
+	return nil
 }
 
 // Request implements Checkout.Request. Does not support Metadata.
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(_ context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
 	params := url.Values{}
 	params.Set("m_shop", c.MerchantID)
 	params.Set("m_orderid", payment.ID)
-	params.Set("m_amount", payment.Amount)
-	params.Set("m_curr", payment.Currency)
+
+	amount := payment.Amount.StringFixed(2)
+	params.Set("m_amount", amount)
+	params.Set("m_curr", payment.Amount.Currency)
 	desc := base64.StdEncoding.EncodeToString([]byte(payment.Comment))
 	params.Set("m_desc", desc)
 
 	a := strings.Join([]string{
 		c.MerchantID,
 		payment.ID,
-		payment.Amount,
-		payment.Currency,
+		amount,
+		payment.Amount.Currency,
 		desc,
 		c.APIKey,
 	}, ":")
@@ -50,70 +103,30 @@ var (
 	timeLoc, _ = time.LoadLocation("Europe/Moscow")
 )
 
-var statuses = map[string]int{
+var statuses = map[string]checkout.Status{
 	"success": checkout.StatusPaid,
+	"fail":    checkout.StatusRejected,
 }
 
 // Webhook implements Checkout.Webhook.
 //
 // Does not support Profit. Amount will be equal to profit
 // if commission is on the buyer.
-//
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			log.Println("checkout/payeer:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		a := []string{
-			r.FormValue("m_operation_id"),
-			r.FormValue("m_operation_ps"),
-			r.FormValue("m_operation_date"),
-			r.FormValue("m_operation_pay_date"),
-			r.FormValue("m_shop"),
-			r.FormValue("m_orderid"),
-			r.FormValue("m_amount"),
-			r.FormValue("m_curr"),
-			r.FormValue("m_desc"),
-			r.FormValue("m_status"),
-		}
-		if r.FormValue("m_params") != "" {
-			a = append(a, r.FormValue("m_params"))
-		}
-		a = append(a, c.APIKey)
-
-		hash := sha256.Sum256([]byte(strings.Join(a, ":")))
-		if r.FormValue("m_sign") != strings.ToUpper(hex.EncodeToString(hash[:])) {
-			log.Println("checkout/payeer: bad request")
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
 
-		paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("m_operation_pay_date"), timeLoc)
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payment, err := c.Parse(r)
 		if err != nil {
-			log.Println("checkout/payeer:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			checkout.WebhookError(w, r, c.Logger, "payeer", err)
 			return
 		}
 
-		comment, _ := base64.StdEncoding.DecodeString(r.FormValue("m_desc"))
-
-		payment := checkout.Payment{
-			Checkout: "payeer",
-			ID:       r.FormValue("m_orderid"),
-			Currency: r.FormValue("m_curr"),
-			Comment:  string(comment),
-			Status:   statuses[r.FormValue("m_status")],
-			Amount:   r.FormValue("m_amount"),
-			Profit:   r.FormValue("summa_out"),
-			PaidAt:   paidAt,
-		}
-
-		if err := callback(payment); err != nil {
-			log.Println("checkout/payeer:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "payeer", err)
 			w.Write([]byte(r.FormValue("m_orderid") + "|error"))
 			return
 		}
@@ -122,3 +135,81 @@ func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
 		w.Write([]byte(r.FormValue("m_orderid") + "|success"))
 	})
 }
+
+// networks are the addresses Payeer sends notifications from.
+var networks = checkout.MustParseNetworks(
+	"185.71.65.92",
+	"185.71.65.189",
+	"149.202.17.210",
+)
+
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return networks
+}
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	return r.FormValue("m_operation_id") != "" && r.FormValue("m_shop") == c.MerchantID
+}
+
+// Signature returns the expected m_sign of the notification form.
+func (c Checkout) Signature(form url.Values) string {
+	a := []string{
+		form.Get("m_operation_id"),
+		form.Get("m_operation_ps"),
+		form.Get("m_operation_date"),
+		form.Get("m_operation_pay_date"),
+		form.Get("m_shop"),
+		form.Get("m_orderid"),
+		form.Get("m_amount"),
+		form.Get("m_curr"),
+		form.Get("m_desc"),
+		form.Get("m_status"),
+	}
+	if form.Get("m_params") != "" {
+		a = append(a, form.Get("m_params"))
+	}
+	a = append(a, c.APIKey)
+
+	hash := sha256.Sum256([]byte(strings.Join(a, ":")))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	if err := r.ParseForm(); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if r.FormValue("m_sign") != c.Signature(r.Form) {
+		return checkout.Payment{}, checkout.ErrBadSignature
+	}
+
+	paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("m_operation_pay_date"), timeLoc)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	amount, err := checkout.ParseMoney(r.FormValue("m_amount"), r.FormValue("m_curr"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	profit, err := checkout.ParseMoney(r.FormValue("summa_out"), r.FormValue("m_curr"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	comment, _ := base64.StdEncoding.DecodeString(r.FormValue("m_desc"))
+
+	return checkout.Payment{
+		Checkout: "payeer",
+		ID:       r.FormValue("m_orderid"),
+		Comment:  string(comment),
+		Status:   statuses[r.FormValue("m_status")],
+		Amount:   amount,
+		Profit:   profit,
+		PaidAt:   paidAt,
+	}, nil
+}
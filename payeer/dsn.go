@@ -0,0 +1,24 @@
+package payeer
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("payeer", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: payeer://merchant:key@?account=...&api_id=...&api_pass=...&api_url=...
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		MerchantID: cfg.User,
+		APIKey:     cfg.Password,
+		Account:    cfg.Get("account"),
+		APIID:      cfg.Get("api_id"),
+		APIPass:    cfg.Get("api_pass"),
+		APIURL:     cfg.Get("api_url"),
+	}
+	if err := cfg.Require("merchant", c.MerchantID, "key", c.APIKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
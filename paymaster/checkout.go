@@ -2,23 +2,27 @@ package paymaster
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"go.massbots.xyz/checkout"
 )
 
 const BaseURL = "https://paymaster.ru/api/v2"
 
-var statuses = map[string]int{
-	"Pending":   checkout.StatusWaiting,
-	"Settled":   checkout.StatusPaid,
-	"Cancelled": checkout.StatusRejected,
+var statuses = map[string]checkout.Status{
+	"Pending":    checkout.StatusWaiting,
+	"Authorized": checkout.StatusWaitingForCapture,
+	"Settled":    checkout.StatusPaid,
+	"Cancelled":  checkout.StatusCanceled,
+	"Rejected":   checkout.StatusRejected,
 }
 
 // Checkout implements checkout.Checkout.
@@ -27,6 +31,13 @@ type Checkout struct {
 	BaseURL    string
 	Token      string
 	MerchantID string
+	Logger     checkout.Logger
+
+	// TestMode requests test payments.
+	TestMode bool
+
+	// Retry is the policy of retrying API calls, none by default.
+	Retry checkout.RetryPolicy
 }
 
 func New(token, merchantID string) Checkout {
@@ -42,6 +53,7 @@ type (
 	Request struct {
 		MerchantID    string        `json:"merchantId"`
 		TestMode      bool          `json:"testMode,omitempty"`
+		DualMode      bool          `json:"dualMode,omitempty"`
 		PaymentMethod string        `json:"paymentMethod,omitempty"`
 		Invoice       *Invoice      `json:"invoice,omitempty"`
 		Amount        *Amount       `json:"amount,omitempty"`
@@ -92,35 +104,84 @@ type (
 	}
 
 	Payment struct {
-		ID        int       `json:"id"`
-		CreatedAt time.Time `json:"created"`
-		Status    string    `json:"status"`
-		Invoice   Invoice   `json:"invoice"`
-		Amount    Amount    `json:"amount"`
+		ID         int       `json:"id"`
+		MerchantID string    `json:"merchantId"`
+		TestMode   bool      `json:"testMode"`
+		CreatedAt  time.Time `json:"created"`
+		Status     string    `json:"status"`
+		Invoice    Invoice   `json:"invoice"`
+		Amount     Amount    `json:"amount"`
 	}
 )
 
+func idempotencyKey() (string, error) {
+	key, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return key.String(), nil
+}
+
+func (c Checkout) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
 func (c Checkout) RawMethod(method string, end string, r, v any, ik string) error {
-	end = c.BaseURL + "/" + end
+	return c.RawMethodContext(context.Background(), method, end, r, v, ik)
+}
 
-	data, err := json.Marshal(r)
-	if err != nil {
-		return err
+// RawMethodContext calls the API endpoint with the given method, encoding r
+// as a request body unless it's nil, and decoding the response into v.
+//
+// Temporary failures are retried according to the retry policy,
+// for GET requests and requests with an idempotency key only.
+func (c Checkout) RawMethodContext(ctx context.Context, method string, end string, r, v any, ik string) error {
+	return c.call(ctx, method, end, "Bearer "+c.Token, r, v, ik)
+}
+
+// call is RawMethodContext with the given Authorization header.
+func (c Checkout) call(ctx context.Context, method, end, auth string, r, v any, ik string) error {
+	var data []byte
+	if r != nil {
+		var err error
+		if data, err = json.Marshal(r); err != nil {
+			return err
+		}
 	}
 
-	req, err := http.NewRequest(method, end, bytes.NewReader(data))
+	attempt := func() error {
+		return c.attempt(ctx, method, end, auth, data, v, ik)
+	}
+	if method != http.MethodGet && ik == "" {
+		return attempt()
+	}
+	return c.Retry.Do(ctx, attempt)
+}
+
+func (c Checkout) attempt(ctx context.Context, method, end, auth string, data []byte, v any, ik string) error {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/"+end, body)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	if ik != "" {
 		req.Header.Set("Idempotency-Key", ik)
 	}
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.client().Do(req)
 	if err != nil {
 		return err
 	}
@@ -135,11 +196,11 @@ func (c Checkout) RawMethod(method string, end string, r, v any, ik string) erro
 		if resp.StatusCode == http.StatusOK {
 			return nil
 		}
-		return fmt.Errorf(
-			"checkout/paymaster: (%d) %v",
-			resp.StatusCode,
-			string(data),
-		)
+		return &checkout.ProviderError{
+			Checkout:   "paymaster",
+			StatusCode: resp.StatusCode,
+			RetryAfter: checkout.RetryAfter(resp),
+		}
 	}
 
 	var maybeError struct {
@@ -149,23 +210,71 @@ func (c Checkout) RawMethod(method string, end string, r, v any, ik string) erro
 
 	err = json.Unmarshal(data, &maybeError)
 	if err == nil && maybeError.Code != "" {
-		return fmt.Errorf(
-			"checkout/paymaster: %s (%s)",
-			maybeError.Code,
-			maybeError.Message,
-		)
+		return &checkout.ProviderError{
+			Checkout:   "paymaster",
+			StatusCode: resp.StatusCode,
+			Code:       maybeError.Code,
+			Message:    maybeError.Message,
+			RetryAfter: checkout.RetryAfter(resp),
+		}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &checkout.ProviderError{
+			Checkout:   "paymaster",
+			StatusCode: resp.StatusCode,
+			Message:    string(data),
+			RetryAfter: checkout.RetryAfter(resp),
+		}
 	}
 
+	if v == nil {
+		return nil
+	}
 	return json.Unmarshal(data, v)
 }
 
 func (c Checkout) Raw(end string, r, v any, ik string) error {
-	return c.RawMethod(http.MethodPost, end, r, v, ik)
+	return c.RawContext(context.Background(), end, r, v, ik)
+}
+
+// RawContext is a shorthand for RawMethodContext with the POST method.
+func (c Checkout) RawContext(ctx context.Context, end string, r, v any, ik string) error {
+	return c.RawMethodContext(ctx, http.MethodPost, end, r, v, ik)
+}
+
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "paymaster",
+		Metadata:   true,
+		Expiration: true,
+		Hold:       true,
+		Refunds:    true,
+		Fields:     []string{"Comment", "SuccessURL", "Type", "CallbackURL", "PaymentMethod", "Customer"},
+		Currencies: []string{checkout.RUB},
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
 }
 
 func (c Checkout) Request(p checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), p)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(ctx context.Context, p checkout.Payment) (string, error) {
+	if err := c.Validate(p); err != nil {
+		return "", err
+	}
+	p = c.Capabilities().Normalize(p)
+
 	req := Request{
 		MerchantID:    c.MerchantID,
+		TestMode:      c.TestMode,
+		DualMode:      p.Hold,
 		PaymentMethod: p.PaymentMethod,
 		Customer:      &Customer{Account: p.Customer},
 
@@ -179,8 +288,8 @@ func (c Checkout) Request(p checkout.Payment) (string, error) {
 			Expires:     &p.ExpirationDate, // a must
 		},
 		Amount: &Amount{
-			Value:    p.Amount,
-			Currency: p.Currency,
+			Value:    p.Amount.StringFixed(2),
+			Currency: p.Amount.Currency,
 		},
 		Tokenization: &Tokenization{
 			Type:        p.Type,
@@ -190,34 +299,27 @@ func (c Checkout) Request(p checkout.Payment) (string, error) {
 	}
 
 	var result map[string]string
-	return result["url"], c.Raw("invoices", req, &result, p.ID)
+	if err := c.RawContext(ctx, "invoices", req, &result, p.ID); err != nil {
+		return "", err
+	}
+	return result["url"], nil
 }
 
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
+
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var p Payment
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			log.Println("checkout/paymaster:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		payment, err := c.Parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, "paymaster", err)
 			return
 		}
 
-		payment := checkout.Payment{
-			Checkout: "paymaster",
-			ID:       strconv.Itoa(p.ID),
-			Amount:   p.Amount.Value,
-			Currency: p.Amount.Currency,
-			Comment:  p.Invoice.Description,
-			Status:   statuses[p.Status],
-			Profit:   p.Amount.Value,
-			PaidAt:   p.CreatedAt,
-			Metadata: p.Invoice.Params,
-			V:        p,
-		}
-
-		if err := callback(payment); err != nil {
-			log.Println("checkout/paymaster:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "paymaster", err)
 			return
 		}
 
@@ -225,16 +327,141 @@ func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
 	})
 }
 
+// Payment implements checkout.Fetcher.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	var result Payment
+	if err := c.RawMethodContext(ctx, http.MethodGet, "payments/"+url.PathEscape(id), nil, &result, ""); err != nil {
+		return checkout.Payment{}, err
+	}
+	return normalize(result)
+}
+
+// Payments implements checkout.Lister.
+func (c Checkout) Payments(ctx context.Context, from, to time.Time) ([]checkout.Payment, error) {
+	params := url.Values{}
+	params.Set("merchantId", c.MerchantID)
+	params.Set("start", from.UTC().Format(time.RFC3339))
+	params.Set("end", to.UTC().Format(time.RFC3339))
+
+	var payments []checkout.Payment
+	for {
+		var result struct {
+			Items  []Payment `json:"items"`
+			Cursor string    `json:"cursor"`
+		}
+		if err := c.RawMethodContext(ctx, http.MethodGet, "payments?"+params.Encode(), nil, &result, ""); err != nil {
+			return nil, err
+		}
+
+		for _, p := range result.Items {
+			payment, err := normalize(p)
+			if err != nil {
+				return nil, err
+			}
+			payments = append(payments, payment)
+		}
+
+		if result.Cursor == "" {
+			return payments, nil
+		}
+		params.Set("cursor", result.Cursor)
+	}
+}
+
+// Capture implements checkout.Capturer.
+func (c Checkout) Capture(ctx context.Context, id string, amount checkout.Money) (checkout.Payment, error) {
+	var req struct {
+		Amount *Amount `json:"amount,omitempty"`
+	}
+	if !amount.IsZero() {
+		req.Amount = &Amount{Value: amount.StringFixed(2), Currency: amount.Currency}
+	}
+
+	ik, err := idempotencyKey()
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	if err := c.RawContext(ctx, "payments/"+url.PathEscape(id)+"/confirm", req, nil, ik); err != nil {
+		return checkout.Payment{}, err
+	}
+	return c.Payment(ctx, id)
+}
+
+// Void implements checkout.Capturer.
+func (c Checkout) Void(ctx context.Context, id string) (checkout.Payment, error) {
+	ik, err := idempotencyKey()
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	if err := c.RawContext(ctx, "payments/"+url.PathEscape(id)+"/cancel", struct{}{}, nil, ik); err != nil {
+		return checkout.Payment{}, err
+	}
+	return c.Payment(ctx, id)
+}
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	var p Payment
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return false
+	}
+	return p.ID != 0 && p.Status != "" && p.MerchantID == c.MerchantID
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	var p Payment
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	payment, err := normalize(p)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	return payment, nil
+}
+
+// normalize converts the original payment into checkout.Payment.
+func normalize(p Payment) (checkout.Payment, error) {
+	amount, err := p.Amount.Money()
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	return checkout.Payment{
+		Checkout: "paymaster",
+		ID:       strconv.Itoa(p.ID),
+		Amount:   amount,
+		Comment:  p.Invoice.Description,
+		Status:   statuses[p.Status],
+		Profit:   amount,
+		PaidAt:   p.CreatedAt,
+		Metadata: p.Invoice.Params,
+		V:        p,
+	}, nil
+}
+
+// Money returns the amount as checkout.Money.
+func (a Amount) Money() (checkout.Money, error) {
+	return checkout.ParseMoney(a.Value, a.Currency)
+}
+
+// UnmarshalJSON accepts both numeric and string values, keeping
+// the value exactly as it was sent.
 func (a *Amount) UnmarshalJSON(b []byte) error {
 	var v struct {
-		Value    float64 `json:"value"`
-		Currency string  `json:"currency"`
+		Value    json.Number `json:"value"`
+		Currency string      `json:"currency"`
 	}
 	if err := json.Unmarshal(b, &v); err != nil {
 		return err
 	}
 
-	a.Value = fmt.Sprint(v.Value)
+	a.Value = v.Value.String()
 	a.Currency = v.Currency
 	return nil
 }
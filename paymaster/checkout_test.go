@@ -0,0 +1,240 @@
+package paymaster_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/paymaster"
+	"go.massbots.xyz/checkout/paymaster/paymastertest"
+)
+
+func TestPaymentRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	srv := paymastertest.NewServer("token", "merchant")
+	defer srv.Close()
+
+	co := srv.Checkout()
+
+	var got []checkout.Payment
+	srv.Webhook = co.WebhookContext(func(_ context.Context, p checkout.Payment) error {
+		got = append(got, p)
+		return nil
+	})
+
+	// The only accepted currency may be omitted.
+	payment := checkout.Payment{
+		ID:             "order-1",
+		Amount:         checkout.MustParseMoney("100.00", ""),
+		Comment:        "Premium",
+		ExpirationDate: time.Now().Add(time.Hour),
+	}
+	link, err := co.RequestContext(ctx, payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(srv.LastID())
+	if link != srv.URL+"/payment/"+id {
+		t.Errorf("link = %q, want the payment page of %s", link, id)
+	}
+
+	// A repeated request is made with the same idempotency key.
+	if again, err := co.RequestContext(ctx, payment); err != nil || again != link {
+		t.Errorf("repeated request = %q, %v, want %q", again, err, link)
+	}
+
+	if err := srv.Pay(srv.LastID()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d notifications, want 1", len(got))
+	}
+	if p := got[0]; p.ID != id || p.Status != checkout.StatusPaid ||
+		!p.Amount.Equal(checkout.MustParseMoney("100", checkout.RUB)) {
+		t.Errorf("notified of %+v", p)
+	}
+
+	p, err := co.Payment(ctx, id)
+	if err != nil || p.Status != checkout.StatusPaid || p.Comment != "Premium" {
+		t.Errorf("Payment = %+v, %v", p, err)
+	}
+	if _, err := co.Payment(ctx, "404"); !errors.Is(err, checkout.ErrPaymentNotFound) {
+		t.Errorf("Payment of a missing ID = %v, want ErrPaymentNotFound", err)
+	}
+
+	list, err := co.Payments(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || len(list) != 1 || list[0].ID != id {
+		t.Errorf("Payments = %v, %v", list, err)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+
+	srv := paymastertest.NewServer("token", "merchant")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	_, err := co.Request(checkout.Payment{
+		ID:             "1",
+		Amount:         checkout.MustParseMoney("100", checkout.RUB),
+		ExpirationDate: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Pay(srv.LastID()); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(srv.LastID())
+
+	thirty := checkout.MustParseMoney("30", checkout.RUB)
+	first, err := co.Refund(ctx, id, thirty, "partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Amount.Equal(thirty) || first.PaymentID != id {
+		t.Errorf("Refund = %+v", first)
+	}
+
+	// A repeated refund isn't made twice.
+	repeated, err := co.Refund(ctx, id, thirty, "partial")
+	if err != nil || repeated.ID != first.ID {
+		t.Errorf("repeated Refund = %+v, %v, want refund %s", repeated, err, first.ID)
+	}
+
+	refunds, err := co.Refunds(ctx, id)
+	if err != nil || len(refunds) != 1 {
+		t.Errorf("Refunds = %v, %v, want one refund", refunds, err)
+	}
+
+	if _, err := co.Refund(ctx, id, checkout.MustParseMoney("71", checkout.RUB), ""); !errors.Is(err, checkout.ErrRefundExceeded) {
+		t.Errorf("Refund over the rest = %v, want ErrRefundExceeded", err)
+	}
+
+	rest, err := co.Refund(ctx, id, checkout.Money{}, "")
+	if err != nil || !rest.Amount.Equal(checkout.MustParseMoney("70", checkout.RUB)) {
+		t.Errorf("Refund of the rest = %+v, %v", rest, err)
+	}
+
+	byID, err := co.RefundByID(ctx, id, rest.ID)
+	if err != nil || byID.ID != rest.ID {
+		t.Errorf("RefundByID = %+v, %v", byID, err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ctx := context.Background()
+
+	srv := paymastertest.NewServer("token", "merchant")
+	defer srv.Close()
+
+	co := srv.Checkout()
+
+	request := func(id string) string {
+		_, err := co.Request(checkout.Payment{
+			ID:             id,
+			Amount:         checkout.MustParseMoney("100", checkout.RUB),
+			ExpirationDate: time.Now().Add(time.Hour),
+			Hold:           true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.Pay(srv.LastID()); err != nil {
+			t.Fatal(err)
+		}
+		return strconv.Itoa(srv.LastID())
+	}
+
+	id := request("1")
+	p, err := co.Payment(ctx, id)
+	if err != nil || p.Status != checkout.StatusWaitingForCapture {
+		t.Fatalf("held payment = %s, %v", p.Status, err)
+	}
+
+	p, err = co.Capture(ctx, id, checkout.Money{})
+	if err != nil || p.Status != checkout.StatusPaid {
+		t.Errorf("Capture = %+v, %v", p, err)
+	}
+
+	id = request("2")
+	p, err = co.Void(ctx, id)
+	if err != nil || p.Status != checkout.StatusCanceled {
+		t.Errorf("Void = %s, %v", p.Status, err)
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	srv := paymastertest.NewServer("token", "merchant")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	_, err := co.Request(checkout.Payment{
+		ID:             "1",
+		Amount:         checkout.MustParseMoney("100", checkout.RUB),
+		ExpirationDate: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(srv.LastID())
+
+	receipt, err := co.CreateReceipt(paymaster.Receipt{
+		PaymentID: id,
+		Amount:    &paymaster.Amount{Value: "100.00", Currency: checkout.RUB},
+		Type:      "Payment",
+		Client:    &paymaster.ReceiptClient{Email: "user@example.com"},
+		Items: []*paymaster.ReceiptItem{
+			{Name: "Premium", Quantity: "1", Price: "100.00", VatType: "None"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byID, err := co.ReceiptByID(receipt.ID)
+	if err != nil || byID.ID != receipt.ID {
+		t.Errorf("ReceiptByID = %+v, %v", byID, err)
+	}
+
+	receipts, err := co.Receipts(id)
+	if err != nil || len(receipts) != 1 || receipts[0].ID != receipt.ID {
+		t.Errorf("Receipts = %v, %v", receipts, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := paymastertest.NewServer("token", "merchant")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	co.Retry = checkout.RetryPolicy{Attempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	srv.Fail(paymastertest.Error{StatusCode: http.StatusServiceUnavailable, Code: "Unavailable"})
+	srv.Fail(paymastertest.Error{StatusCode: http.StatusTooManyRequests, Code: "TooManyRequests"})
+
+	payment := checkout.Payment{
+		ID:             "1",
+		Amount:         checkout.MustParseMoney("100", checkout.RUB),
+		ExpirationDate: time.Now().Add(time.Hour),
+	}
+	if _, err := co.Request(payment); err != nil {
+		t.Fatalf("Request after temporary failures: %v", err)
+	}
+
+	srv.Fail(paymastertest.Error{StatusCode: http.StatusBadRequest, Code: "ValidationError"})
+	srv.Fail(paymastertest.Error{StatusCode: http.StatusServiceUnavailable, Code: "Unavailable"})
+
+	payment.ID = "2"
+	_, err := co.Request(payment)
+	var perr *checkout.ProviderError
+	if !errors.As(err, &perr) || perr.Code != "ValidationError" {
+		t.Errorf("Request = %v, want the ValidationError unretried", err)
+	}
+}
@@ -0,0 +1,28 @@
+package paymaster
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("paymaster", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: paymaster://merchant:token@?base_url=...&test=1&retry=3
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := New(cfg.Password, cfg.User)
+	if base := cfg.Get("base_url"); base != "" {
+		c.BaseURL = base
+	}
+	c.TestMode = cfg.Bool("test")
+
+	retry, err := cfg.Int("retry")
+	if err != nil {
+		return nil, err
+	}
+	c.Retry.Attempts = retry
+
+	if err := cfg.Require("merchant", c.MerchantID, "token", c.Token); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
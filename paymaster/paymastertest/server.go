@@ -0,0 +1,557 @@
+// Package paymastertest provides a fake Paymaster API for tests.
+//
+// The server keeps invoices, refunds and receipts in memory, honours
+// idempotency keys and sends notifications to the configured webhook:
+//
+//	srv := paymastertest.NewServer("token", "merchant")
+//	defer srv.Close()
+//
+//	co := srv.Checkout()
+//	srv.Webhook = co.Webhook(callback)
+//
+//	link, _ := co.Request(payment)
+//	srv.Pay(srv.LastID()) // callback is called with the settled payment
+package paymastertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/paymaster"
+)
+
+// Server is a fake Paymaster API.
+type Server struct {
+	*httptest.Server
+
+	Token      string
+	MerchantID string
+
+	// Webhook receives notifications on every payment change, if it's set.
+	Webhook http.Handler
+
+	mu         sync.Mutex
+	seq        int
+	payments   map[int]*payment
+	refunds    map[int]paymaster.Refund
+	receipts   map[string]paymaster.Receipt
+	keys       map[string]response
+	failures   []Error
+	deliveries []Delivery
+	last       int
+}
+
+type (
+	// Error is an error response of the API.
+	Error struct {
+		StatusCode int    `json:"-"`
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+
+		// RetryAfter is sent as the Retry-After header, unless zero.
+		RetryAfter time.Duration `json:"-"`
+	}
+
+	// Delivery is a notification sent to the webhook.
+	Delivery struct {
+		PaymentID  int
+		Status     string
+		StatusCode int
+	}
+
+	payment struct {
+		paymaster.Payment
+		dual bool
+	}
+
+	response struct {
+		status  int
+		body    []byte
+		request []byte
+	}
+)
+
+// NewServer starts a fake API accepting the given token and merchant.
+// The caller should call Close when finished.
+func NewServer(token, merchantID string) *Server {
+	s := &Server{
+		Token:      token,
+		MerchantID: merchantID,
+		payments:   make(map[int]*payment),
+		refunds:    make(map[int]paymaster.Refund),
+		receipts:   make(map[string]paymaster.Receipt),
+		keys:       make(map[string]response),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Checkout returns a checkout pointed at the server.
+func (s *Server) Checkout() paymaster.Checkout {
+	return paymaster.Checkout{
+		Client:     s.Client(),
+		BaseURL:    s.URL,
+		Token:      s.Token,
+		MerchantID: s.MerchantID,
+	}
+}
+
+// Payment returns the payment by its ID.
+func (s *Server) Payment(id int) (paymaster.Payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[id]
+	if !ok {
+		return paymaster.Payment{}, false
+	}
+	return p.Payment, true
+}
+
+// LastID returns the ID of the last created payment.
+func (s *Server) LastID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Deliveries returns the notifications sent to the webhook so far.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// Fail makes the next API call answer with the error.
+// Calls fail in the order errors were added.
+func (s *Server) Fail(e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, e)
+}
+
+// Pay simulates the customer paying the pending invoice. The payment
+// is settled right away or authorized in the dual mode.
+func (s *Server) Pay(id int) error {
+	status := "Settled"
+
+	s.mu.Lock()
+	if p, ok := s.payments[id]; ok && p.dual {
+		status = "Authorized"
+	}
+	s.mu.Unlock()
+
+	return s.set(id, status, "Pending")
+}
+
+// Reject simulates the payment being rejected by the bank.
+func (s *Server) Reject(id int) error {
+	return s.set(id, "Rejected", "Pending", "Authorized")
+}
+
+// Notify sends the payment to the webhook and returns its status code.
+func (s *Server) Notify(p paymaster.Payment) int {
+	if s.Webhook == nil {
+		return 0
+	}
+
+	data, _ := json.Marshal(p)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	s.Webhook.ServeHTTP(w, r)
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, Delivery{
+		PaymentID:  p.ID,
+		Status:     p.Status,
+		StatusCode: w.Code,
+	})
+	s.mu.Unlock()
+
+	return w.Code
+}
+
+// set moves the payment to the status if it's in one of the given
+// statuses and notifies the webhook.
+func (s *Server) set(id int, status string, from ...string) error {
+	s.mu.Lock()
+	p, ok := s.payments[id]
+	if !ok || !oneOf(p.Status, from...) {
+		s.mu.Unlock()
+		return fmt.Errorf("paymastertest: payment %d can't become %s", id, status)
+	}
+	p.Status = status
+	payment := p.Payment
+	s.mu.Unlock()
+
+	s.Notify(payment)
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+
+	status, v, notify := s.handle(r, body.Bytes())
+
+	w.Header().Set("Content-Type", "application/json")
+	if e, ok := v.(Error); ok && e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(e.RetryAfter.Seconds())))
+	}
+	w.WriteHeader(status)
+	if v != nil {
+		data, _ := json.Marshal(v)
+		w.Write(data)
+	}
+
+	for _, p := range notify {
+		s.Notify(p)
+	}
+}
+
+func (s *Server) handle(r *http.Request, body []byte) (int, any, []paymaster.Payment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Receipts are authorized by the bare token.
+	auth := "Bearer " + s.Token
+	if strings.HasPrefix(strings.Trim(r.URL.Path, "/"), "receipts") {
+		auth = s.Token
+	}
+	if r.Header.Get("Authorization") != auth {
+		return s.errorResponse(Error{
+			StatusCode: http.StatusUnauthorized,
+			Code:       "Unauthorized",
+			Message:    "Invalid access token",
+		})
+	}
+
+	if len(s.failures) > 0 {
+		e := s.failures[0]
+		s.failures = s.failures[1:]
+		return s.errorResponse(e)
+	}
+
+	ik := r.Header.Get("Idempotency-Key")
+	if r.Method != http.MethodPost || ik == "" {
+		return s.route(r, body)
+	}
+
+	key := r.URL.Path + " " + ik
+	if resp, ok := s.keys[key]; ok {
+		if !bytes.Equal(resp.request, body) {
+			return s.errorResponse(Error{
+				StatusCode: http.StatusConflict,
+				Code:       "IdempotencyKeyConflict",
+				Message:    "Idempotency key was used with another request",
+			})
+		}
+		return resp.status, json.RawMessage(resp.body), nil
+	}
+
+	status, v, notify := s.route(r, body)
+	if status < http.StatusInternalServerError {
+		data, _ := json.Marshal(v)
+		s.keys[key] = response{status: status, body: data, request: body}
+	}
+	return status, v, notify
+}
+
+func (s *Server) route(r *http.Request, body []byte) (int, any, []paymaster.Payment) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "invoices":
+		return s.createInvoice(body)
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "payments":
+		return s.listPayments(query)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "payments":
+		p, ok := s.payment(parts[1])
+		if !ok {
+			return s.notFound()
+		}
+		return http.StatusOK, p.Payment, nil
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "payments" && parts[2] == "confirm":
+		return s.confirm(parts[1], body)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "payments" && parts[2] == "cancel":
+		return s.cancel(parts[1])
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "refunds":
+		return s.createRefund(body)
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "refunds":
+		return http.StatusOK, s.paymentRefunds(query.Get("paymentId")), nil
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "refunds":
+		id, _ := strconv.Atoi(parts[1])
+		refund, ok := s.refunds[id]
+		if !ok {
+			return s.notFound()
+		}
+		return http.StatusOK, refund, nil
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "receipts" && !query.Has("paymentId"):
+		return s.createReceipt(body)
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "receipts":
+		receipts := []paymaster.Receipt{}
+		for _, receipt := range s.receipts {
+			if receipt.PaymentID == query.Get("paymentId") {
+				receipts = append(receipts, receipt)
+			}
+		}
+		return http.StatusOK, receipts, nil
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "receipts":
+		receipt, ok := s.receipts[parts[1]]
+		if !ok {
+			return s.notFound()
+		}
+		return http.StatusOK, receipt, nil
+	}
+
+	return s.notFound()
+}
+
+func (s *Server) createInvoice(body []byte) (int, any, []paymaster.Payment) {
+	var req paymaster.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid(err.Error())
+	}
+	if req.MerchantID != s.MerchantID {
+		return s.errorResponse(Error{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InvalidMerchant",
+			Message:    "Unknown merchant " + req.MerchantID,
+		})
+	}
+	if req.Amount == nil || !valid(*req.Amount) {
+		return s.invalid("Invalid amount")
+	}
+
+	s.seq++
+	p := &payment{dual: req.DualMode}
+	p.ID = s.seq
+	p.MerchantID = req.MerchantID
+	p.TestMode = req.TestMode
+	p.CreatedAt = time.Now()
+	p.Status = "Pending"
+	p.Amount = *req.Amount
+	if req.Invoice != nil {
+		p.Invoice = *req.Invoice
+	}
+
+	s.payments[p.ID] = p
+	s.last = p.ID
+
+	id := strconv.Itoa(p.ID)
+	return http.StatusOK, map[string]string{
+		"paymentId": id,
+		"url":       s.URL + "/payment/" + id,
+	}, nil
+}
+
+// listPayments returns the merchant's payments created within the period,
+// in the order of their IDs.
+func (s *Server) listPayments(q url.Values) (int, any, []paymaster.Payment) {
+	if q.Get("merchantId") != s.MerchantID {
+		return s.errorResponse(Error{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InvalidMerchant",
+			Message:    "Unknown merchant " + q.Get("merchantId"),
+		})
+	}
+
+	start, err := time.Parse(time.RFC3339, q.Get("start"))
+	if err != nil {
+		return s.invalid("Invalid start")
+	}
+	end, err := time.Parse(time.RFC3339, q.Get("end"))
+	if err != nil {
+		return s.invalid("Invalid end")
+	}
+
+	items := []paymaster.Payment{}
+	for _, p := range s.payments {
+		if p.CreatedAt.Before(start) || !p.CreatedAt.Before(end) {
+			continue
+		}
+		items = append(items, p.Payment)
+	}
+	sort.Slice(items, func(i, k int) bool {
+		return items[i].ID < items[k].ID
+	})
+
+	return http.StatusOK, map[string]any{"items": items}, nil
+}
+
+func (s *Server) confirm(id string, body []byte) (int, any, []paymaster.Payment) {
+	p, ok := s.payment(id)
+	if !ok {
+		return s.notFound()
+	}
+	if p.Status != "Authorized" {
+		return s.invalid("Payment is " + p.Status)
+	}
+
+	var req struct {
+		Amount *paymaster.Amount `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid(err.Error())
+	}
+	if req.Amount != nil {
+		if !valid(*req.Amount) {
+			return s.invalid("Invalid amount")
+		}
+		if cmp, err := money(*req.Amount).Cmp(money(p.Amount)); err != nil || cmp > 0 {
+			return s.invalid("Confirmation amount exceeds the payment amount")
+		}
+		p.Amount = *req.Amount
+	}
+
+	p.Status = "Settled"
+	return http.StatusOK, nil, []paymaster.Payment{p.Payment}
+}
+
+func (s *Server) cancel(id string) (int, any, []paymaster.Payment) {
+	p, ok := s.payment(id)
+	if !ok {
+		return s.notFound()
+	}
+	if !oneOf(p.Status, "Pending", "Authorized") {
+		return s.invalid("Payment is " + p.Status)
+	}
+
+	p.Status = "Cancelled"
+	return http.StatusOK, nil, []paymaster.Payment{p.Payment}
+}
+
+func (s *Server) createRefund(body []byte) (int, any, []paymaster.Payment) {
+	var req paymaster.Refund
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid(err.Error())
+	}
+
+	p, ok := s.payment(req.PaymentID)
+	if !ok {
+		return s.invalid("Unknown payment " + req.PaymentID)
+	}
+	if p.Status != "Settled" {
+		return s.invalid("Payment is " + p.Status)
+	}
+	if req.Amount == nil || !valid(*req.Amount) {
+		return s.invalid("Invalid amount")
+	}
+
+	total := money(*req.Amount)
+	for _, r := range s.paymentRefunds(req.PaymentID) {
+		var err error
+		if total, err = total.Add(money(*r.Amount)); err != nil {
+			return s.invalid(err.Error())
+		}
+	}
+	if cmp, err := total.Cmp(money(p.Amount)); err != nil || cmp > 0 {
+		return s.invalid("Refund amount exceeds the payment amount")
+	}
+
+	s.seq++
+	now := time.Now()
+	refund := paymaster.Refund{
+		ID:        s.seq,
+		CreatedAt: &now,
+		PaymentID: req.PaymentID,
+		Amount:    req.Amount,
+		Status:    "Success",
+	}
+	s.refunds[refund.ID] = refund
+
+	return http.StatusOK, refund, nil
+}
+
+func (s *Server) paymentRefunds(paymentID string) []paymaster.Refund {
+	refunds := []paymaster.Refund{}
+	for id := 1; id <= s.seq; id++ {
+		if r, ok := s.refunds[id]; ok && r.PaymentID == paymentID {
+			refunds = append(refunds, r)
+		}
+	}
+	return refunds
+}
+
+func (s *Server) createReceipt(body []byte) (int, any, []paymaster.Payment) {
+	var req paymaster.Receipt
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid(err.Error())
+	}
+	if _, ok := s.payment(req.PaymentID); !ok {
+		return s.invalid("Unknown payment " + req.PaymentID)
+	}
+	if len(req.Items) == 0 {
+		return s.invalid("Receipt has no items")
+	}
+
+	s.seq++
+	now := time.Now()
+	req.ID = strconv.Itoa(s.seq)
+	req.CreatedAt = &now
+	req.Status = "Success"
+	s.receipts[req.ID] = req
+
+	return http.StatusOK, req, nil
+}
+
+func (s *Server) payment(id string) (*payment, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, false
+	}
+	p, ok := s.payments[n]
+	return p, ok
+}
+
+func (s *Server) invalid(message string) (int, any, []paymaster.Payment) {
+	return s.errorResponse(Error{
+		StatusCode: http.StatusBadRequest,
+		Code:       "ValidationError",
+		Message:    message,
+	})
+}
+
+func (s *Server) notFound() (int, any, []paymaster.Payment) {
+	return s.errorResponse(Error{
+		StatusCode: http.StatusNotFound,
+		Code:       "NotFound",
+		Message:    "Object not found",
+	})
+}
+
+func (s *Server) errorResponse(e Error) (int, any, []paymaster.Payment) {
+	return e.StatusCode, e, nil
+}
+
+func valid(a paymaster.Amount) bool {
+	m, err := a.Money()
+	return err == nil && m.IsPositive() && a.Currency != ""
+}
+
+func money(a paymaster.Amount) checkout.Money {
+	m, _ := a.Money()
+	return m
+}
+
+func oneOf(s string, list ...string) bool {
+	for _, v := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,7 @@
 package paymaster
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
 	"net/url"
 	"time"
@@ -65,68 +64,51 @@ type (
 	}
 )
 
+// CreateReceipt creates a receipt. Receipt calls are authorized by the bare
+// token and look receipts up with POST, unlike the rest of the API.
 func (c Checkout) CreateReceipt(r Receipt) (*Receipt, error) {
-	end := c.BaseURL + "/receipts"
-
-	data, err := json.Marshal(r)
-	if err != nil {
-		return nil, err
-	}
+	return c.CreateReceiptContext(context.Background(), r)
+}
 
-	req, err := http.NewRequest(http.MethodPost, end, bytes.NewReader(data))
+// CreateReceiptContext is like CreateReceipt but uses ctx for the API call.
+func (c Checkout) CreateReceiptContext(ctx context.Context, r Receipt) (*Receipt, error) {
+	ik, err := idempotencyKey()
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", c.Token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	var result Receipt
+	if err := c.call(ctx, http.MethodPost, "receipts", c.Token, r, &result, ik); err != nil {
 		return nil, err
 	}
-
-	defer resp.Body.Close()
-	return &r, json.NewDecoder(resp.Body).Decode(&r)
+	return &result, nil
 }
 
-func (c Checkout) ReceiptByID(id string) (r *Receipt, err error) {
-	end := c.BaseURL + "/receipts/" + id
-
-	req, err := http.NewRequest(http.MethodPost, end, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", c.Token)
+func (c Checkout) ReceiptByID(id string) (*Receipt, error) {
+	return c.ReceiptByIDContext(context.Background(), id)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+// ReceiptByIDContext is like ReceiptByID but uses ctx for the API call.
+func (c Checkout) ReceiptByIDContext(ctx context.Context, id string) (*Receipt, error) {
+	var result Receipt
+	if err := c.call(ctx, http.MethodPost, "receipts/"+url.PathEscape(id), c.Token, nil, &result, ""); err != nil {
 		return nil, err
 	}
+	return &result, nil
+}
 
-	defer resp.Body.Close()
-	return r, json.NewDecoder(resp.Body).Decode(r)
+func (c Checkout) Receipts(paymentID string) ([]Receipt, error) {
+	return c.ReceiptsContext(context.Background(), paymentID)
 }
 
-func (c Checkout) Receipts(paymentID string) (r []Receipt, err error) {
+// ReceiptsContext is like Receipts but uses ctx for the API call.
+func (c Checkout) ReceiptsContext(ctx context.Context, paymentID string) ([]Receipt, error) {
 	params := url.Values{}
 	params.Set("paymentId", paymentID)
 
-	end := c.BaseURL + "/receipts" + params.Encode()
-
-	req, err := http.NewRequest(http.MethodPost, end, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", c.Token)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	var result []Receipt
+	if err := c.call(ctx, http.MethodPost, "receipts?"+params.Encode(), c.Token, nil, &result, ""); err != nil {
 		return nil, err
 	}
-
-	defer resp.Body.Close()
-	return r, json.NewDecoder(resp.Body).Decode(&r)
+	return result, nil
 }
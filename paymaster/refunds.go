@@ -0,0 +1,125 @@
+package paymaster
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+type (
+	Refund struct {
+		ID        int        `json:"id,omitempty"`
+		CreatedAt *time.Time `json:"created,omitempty"`
+		PaymentID string     `json:"paymentId,omitempty"`
+		Amount    *Amount    `json:"amount,omitempty"`
+		Status    string     `json:"status,omitempty"`
+	}
+)
+
+var refundStatuses = map[string]checkout.Status{
+	"Pending":  checkout.StatusWaiting,
+	"Success":  checkout.StatusRefunded,
+	"Rejected": checkout.StatusRejected,
+}
+
+// Refunds returns refunds of the payment.
+func (c Checkout) Refunds(ctx context.Context, paymentID string) ([]Refund, error) {
+	params := url.Values{}
+	params.Set("paymentId", paymentID)
+
+	var result []Refund
+	if err := c.RawMethodContext(ctx, http.MethodGet, "refunds?"+params.Encode(), nil, &result, ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Refund implements checkout.Refunder. The refund is made with the
+// idempotency key of checkout.RefundKey.
+func (c Checkout) Refund(ctx context.Context, paymentID string, amount checkout.Money, reason string) (checkout.Refund, error) {
+	payment, err := c.Payment(ctx, paymentID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if !checkout.Refundable(payment.Status) {
+		return checkout.Refund{}, checkout.ErrNotRefundable
+	}
+
+	refunds, err := c.Refunds(ctx, paymentID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	refunded := checkout.Money{Currency: payment.Amount.Currency}
+	for _, r := range refunds {
+		if r.Amount == nil || refundStatuses[r.Status] == checkout.StatusRejected {
+			continue
+		}
+		m, err := r.Amount.Money()
+		if err != nil {
+			return checkout.Refund{}, err
+		}
+		if refunded, err = refunded.Add(m); err != nil {
+			return checkout.Refund{}, err
+		}
+	}
+
+	ik := checkout.RefundKey(ctx, paymentID, amount, reason)
+	amount, err = checkout.RefundAmount(payment.Amount, refunded, amount)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	req := Refund{
+		PaymentID: paymentID,
+		Amount: &Amount{
+			Value:    amount.StringFixed(2),
+			Currency: amount.Currency,
+		},
+	}
+
+	var result Refund
+	if err := c.RawContext(ctx, "refunds", req, &result, ik); err != nil {
+		return checkout.Refund{}, err
+	}
+
+	refund, err := result.refund()
+	refund.Reason = reason
+	return refund, err
+}
+
+// RefundByID implements checkout.Refunder.
+func (c Checkout) RefundByID(ctx context.Context, _, refundID string) (checkout.Refund, error) {
+	var result Refund
+	if err := c.RawMethodContext(ctx, http.MethodGet, "refunds/"+url.PathEscape(refundID), nil, &result, ""); err != nil {
+		return checkout.Refund{}, err
+	}
+	return result.refund()
+}
+
+func (r Refund) refund() (checkout.Refund, error) {
+	refund := checkout.Refund{
+		ID:        strconv.Itoa(r.ID),
+		PaymentID: r.PaymentID,
+		Checkout:  "paymaster",
+		Status:    refundStatuses[r.Status],
+		V:         r,
+	}
+
+	if r.CreatedAt != nil {
+		refund.CreatedAt = *r.CreatedAt
+	}
+	if r.Amount != nil {
+		amount, err := r.Amount.Money()
+		if err != nil {
+			return checkout.Refund{}, err
+		}
+		refund.Amount = amount
+	}
+
+	return refund, nil
+}
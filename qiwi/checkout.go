@@ -1,13 +1,16 @@
 package qiwi
 
 import (
+	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 	"time"
@@ -15,14 +18,27 @@ import (
 	"go.massbots.xyz/checkout"
 )
 
-const BaseURL = "https://oplata.qiwi.com/create?"
+const (
+	BaseURL = "https://oplata.qiwi.com/create?"
+	APIURL  = "https://api.qiwi.com/partner/bill/v1/bills/"
+)
 
 type (
 	// Checkout implements checkout.Checkout.
 	Checkout struct {
 		BaseURL   string
+		APIURL    string
 		PublicKey string
 		SecretKey string
+		Logger    checkout.Logger
+
+		// Client defaults to http.DefaultClient.
+		Client *http.Client
+	}
+
+	Amount struct {
+		Value    string `json:"value"`
+		Currency string `json:"currency"`
 	}
 
 	Payment struct {
@@ -32,11 +48,7 @@ type (
 		Comment            string            `json:"comment"`
 		CreationDateTime   string            `json:"creationDateTime"`
 		ExpirationDateTime string            `json:"expirationDateTime"`
-
-		Amount struct {
-			Value    string `json:"value"`
-			Currency string `json:"currency"`
-		} `json:"amount"`
+		Amount             Amount            `json:"amount"`
 
 		Status struct {
 			Value           string `json:"value"`
@@ -57,7 +69,35 @@ func From(payment checkout.Payment) Payment {
 	return p
 }
 
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "qiwi",
+		Metadata:   true,
+		Expiration: true,
+		Refunds:    true,
+		Fields:     []string{"Comment", "SuccessURL"},
+		Currencies: []string{checkout.RUB},
+		MaxComment: 255,
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
+}
+
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(_ context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
 	if c.BaseURL == "" {
 		c.BaseURL = BaseURL
 	}
@@ -65,7 +105,7 @@ func (c Checkout) Request(payment checkout.Payment) (string, error) {
 	params := url.Values{}
 	params.Set("publicKey", c.PublicKey)
 	params.Set("billId", payment.ID)
-	params.Set("amount", payment.Amount)
+	params.Set("amount", payment.Amount.StringFixed(2))
 	params.Set("comment", payment.Comment)
 	params.Set("successUrl", payment.SuccessURL)
 
@@ -81,7 +121,7 @@ func (c Checkout) Request(payment checkout.Payment) (string, error) {
 
 var timeLayout = "2006-01-02T15:04:05-07"
 
-var statuses = map[string]int{
+var statuses = map[string]checkout.Status{
 	"WAITING":  checkout.StatusWaiting,
 	"PAID":     checkout.StatusPaid,
 	"REJECTED": checkout.StatusRejected,
@@ -89,59 +129,186 @@ var statuses = map[string]int{
 }
 
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
+
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var bill struct {
-			Payment Payment `json:"bill"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&bill); err != nil {
-			log.Println("checkout/qiwi:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		payment, err := c.Parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, "qiwi", err)
 			return
 		}
 
-		paidAt, err := time.Parse(timeLayout, bill.Payment.CreationDateTime)
-		if err != nil {
-			log.Println("checkout/qiwi:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "qiwi", err)
 			return
 		}
 
-		payment := checkout.Payment{
-			Checkout: "qiwi",
-			ID:       bill.Payment.BillID,
-			Currency: bill.Payment.Amount.Currency,
-			Comment:  bill.Payment.Comment,
-			Metadata: bill.Payment.CustomFields,
-			Status:   statuses[bill.Payment.Status.Value],
-			Profit:   bill.Payment.Amount.Value,
-			PaidAt:   paidAt,
-			V:        bill.Payment,
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// networks are the addresses Qiwi sends notifications from.
+var networks = checkout.MustParseNetworks(
+	"79.142.16.0/20",
+	"195.189.100.0/22",
+	"91.232.230.0/23",
+	"91.213.51.0/24",
+)
+
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return networks
+}
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	if r.Header.Get("X-Api-Signature-SHA256") == "" {
+		return false
+	}
+
+	var bill struct {
+		Payment *Payment `json:"bill"`
+	}
+	return json.NewDecoder(r.Body).Decode(&bill) == nil && bill.Payment != nil
+}
+
+// Signature returns the expected X-Api-Signature-SHA256 header
+// of the bill notification.
+func (c Checkout) Signature(p Payment) string {
+	a := strings.Join([]string{
+		p.Amount.Currency,
+		p.Amount.Value,
+		p.BillID,
+		p.SiteID,
+		p.Status.Value,
+	}, "|")
+
+	hash := hmac.New(sha256.New, []byte(c.SecretKey))
+	hash.Write([]byte(a))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	var bill struct {
+		Payment Payment `json:"bill"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&bill); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if r.Header.Get("X-Api-Signature-SHA256") != c.Signature(bill.Payment) {
+		return checkout.Payment{}, checkout.ErrBadSignature
+	}
+
+	payment, err := normalize(bill.Payment)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	return payment, nil
+}
+
+// normalize converts the original payment into checkout.Payment.
+func normalize(p Payment) (checkout.Payment, error) {
+	paidAt, err := parseTime(p.CreationDateTime)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	amount, err := checkout.ParseMoney(p.Amount.Value, p.Amount.Currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	return checkout.Payment{
+		Checkout: "qiwi",
+		ID:       p.BillID,
+		Amount:   amount,
+		Comment:  p.Comment,
+		Metadata: p.CustomFields,
+		Status:   statuses[p.Status.Value],
+		Profit:   amount,
+		PaidAt:   paidAt,
+		V:        p,
+	}, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		// API responses carry full offsets, e.g. "+03:00".
+		return time.Parse(time.RFC3339, s)
+	}
+	return t, nil
+}
+
+// Payment implements checkout.Fetcher.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	var result Payment
+	if err := c.do(ctx, http.MethodGet, url.PathEscape(id), nil, &result); err != nil {
+		return checkout.Payment{}, err
+	}
+	return normalize(result)
+}
+
+func (c Checkout) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// do calls the bills API, encoding r as a request body unless it's nil,
+// and decoding the response into v.
+func (c Checkout) do(ctx context.Context, method, end string, r, v any) error {
+	if c.APIURL == "" {
+		c.APIURL = APIURL
+	}
+
+	var body io.Reader
+	if r != nil {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
 		}
+		body = bytes.NewReader(data)
+	}
 
-		a := strings.Join([]string{
-			payment.Currency,
-			payment.Profit,
-			payment.ID,
-			bill.Payment.SiteID,
-			bill.Payment.Status.Value,
-		}, "|")
-
-		hash := hmac.New(sha256.New, []byte(c.SecretKey))
-		hash.Write([]byte(a))
-
-		sign := r.Header.Get("X-Api-Signature-SHA256")
-		if sign != hex.EncodeToString(hash.Sum(nil)) {
-			log.Println("checkout/qiwi: bad signature")
-			w.WriteHeader(http.StatusForbidden)
-			return
+	req, err := http.NewRequestWithContext(ctx, method, c.APIURL+end, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.SecretKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e struct {
+			Code        string `json:"errorCode"`
+			Description string `json:"description"`
 		}
+		json.NewDecoder(resp.Body).Decode(&e)
 
-		if err := callback(payment); err != nil {
-			log.Println("checkout/qiwi:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		return &checkout.ProviderError{
+			Checkout:   "qiwi",
+			StatusCode: resp.StatusCode,
+			Code:       e.Code,
+			Message:    e.Description,
 		}
+	}
 
-		w.WriteHeader(http.StatusOK)
-	})
+	return json.NewDecoder(resp.Body).Decode(v)
 }
@@ -0,0 +1,22 @@
+package qiwi
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("qiwi", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: qiwi://public:secret@?base_url=...&api_url=...
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		PublicKey: cfg.User,
+		SecretKey: cfg.Password,
+		BaseURL:   cfg.Get("base_url"),
+		APIURL:    cfg.Get("api_url"),
+	}
+	if err := cfg.Require("public key", c.PublicKey, "secret key", c.SecretKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package qiwi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"go.massbots.xyz/checkout"
+)
+
+type (
+	Refund struct {
+		ID       string `json:"refundId,omitempty"`
+		Amount   Amount `json:"amount"`
+		Datetime string `json:"datetime,omitempty"`
+		Status   string `json:"status,omitempty"`
+	}
+)
+
+var refundStatuses = map[string]checkout.Status{
+	"PARTIAL":  checkout.StatusRefunded,
+	"FULL":     checkout.StatusRefunded,
+	"REJECTED": checkout.StatusRejected,
+}
+
+// Refunds returns refunds of the bill.
+func (c Checkout) Refunds(ctx context.Context, billID string) ([]Refund, error) {
+	var result []Refund
+	if err := c.do(ctx, http.MethodGet, url.PathEscape(billID)+"/refunds", nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Refund implements checkout.Refunder. Qiwi doesn't store
+// a reason of the refund. The refund ID is checkout.RefundKey.
+func (c Checkout) Refund(ctx context.Context, billID string, amount checkout.Money, reason string) (checkout.Refund, error) {
+	payment, err := c.Payment(ctx, billID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if !checkout.Refundable(payment.Status) {
+		return checkout.Refund{}, checkout.ErrNotRefundable
+	}
+
+	refunds, err := c.Refunds(ctx, billID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	refunded := checkout.Money{Currency: payment.Amount.Currency}
+	for _, r := range refunds {
+		if refundStatuses[r.Status] == checkout.StatusRejected {
+			continue
+		}
+		m, err := checkout.ParseMoney(r.Amount.Value, r.Amount.Currency)
+		if err != nil {
+			return checkout.Refund{}, err
+		}
+		if refunded, err = refunded.Add(m); err != nil {
+			return checkout.Refund{}, err
+		}
+	}
+
+	id := checkout.RefundKey(ctx, billID, amount, reason)
+	amount, err = checkout.RefundAmount(payment.Amount, refunded, amount)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	req := Refund{
+		Amount: Amount{Value: amount.StringFixed(2), Currency: amount.Currency},
+	}
+
+	var result Refund
+	end := url.PathEscape(billID) + "/refunds/" + url.PathEscape(id)
+	if err := c.do(ctx, http.MethodPut, end, req, &result); err != nil {
+		return checkout.Refund{}, err
+	}
+
+	refund, err := result.refund(billID)
+	refund.Reason = reason
+	return refund, err
+}
+
+// RefundByID implements checkout.Refunder.
+func (c Checkout) RefundByID(ctx context.Context, billID, refundID string) (checkout.Refund, error) {
+	var result Refund
+	end := url.PathEscape(billID) + "/refunds/" + url.PathEscape(refundID)
+	if err := c.do(ctx, http.MethodGet, end, nil, &result); err != nil {
+		return checkout.Refund{}, err
+	}
+	return result.refund(billID)
+}
+
+func (r Refund) refund(billID string) (checkout.Refund, error) {
+	amount, err := checkout.ParseMoney(r.Amount.Value, r.Amount.Currency)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	createdAt, _ := parseTime(r.Datetime)
+
+	return checkout.Refund{
+		ID:        r.ID,
+		PaymentID: billID,
+		Checkout:  "qiwi",
+		Amount:    amount,
+		CreatedAt: createdAt,
+		Status:    refundStatuses[r.Status],
+		V:         r,
+	}, nil
+}
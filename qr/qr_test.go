@@ -0,0 +1,296 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Vectors are from ISO/IEC 18004 and its annexes.
+
+func TestRSRemainder(t *testing.T) {
+	// 1-M "HELLO WORLD" in alphanumeric mode.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	tests := []struct {
+		level Level
+		mask  int
+		want  string
+	}{
+		{Low, 0, "111011111000100"},
+		{Low, 4, "110011000101111"},
+		{Medium, 0, "101010000010010"},
+		{Medium, 5, "100000011001110"},
+		{Quartile, 2, "011111100110001"},
+		{High, 7, "000100000111011"},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprintf("%015b", formatBits(tt.level, tt.mask)); got != tt.want {
+			t.Errorf("formatBits(%d, %d) = %s, want %s", tt.level, tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{7, "000111110010010100"},
+		{8, "001000010110111100"},
+		{21, "010101011010000011"},
+		{40, "101000110001101001"},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprintf("%018b", versionBits(tt.version)); got != tt.want {
+			t.Errorf("versionBits(%d) = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	tests := []struct {
+		version int
+		want    []int
+	}{
+		{1, nil},
+		{2, []int{6, 18}},
+		{7, []int{6, 22, 38}},
+		{32, []int{6, 34, 60, 86, 112, 138}},
+		{36, []int{6, 24, 50, 76, 102, 128, 154}},
+		{40, []int{6, 30, 58, 86, 114, 142, 170}},
+	}
+
+	for _, tt := range tests {
+		if got := alignmentPositions(tt.version); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("alignmentPositions(%d) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Bytes by version and level L, M, Q, H.
+	tests := []struct {
+		version  int
+		capacity [4]int
+	}{
+		{1, [4]int{17, 14, 11, 7}},
+		{2, [4]int{32, 26, 20, 14}},
+		{3, [4]int{53, 42, 32, 24}},
+		{4, [4]int{78, 62, 46, 34}},
+		{5, [4]int{106, 84, 60, 44}},
+		{10, [4]int{271, 213, 151, 119}},
+		{20, [4]int{858, 666, 482, 382}},
+		{27, [4]int{1465, 1125, 805, 625}},
+		{40, [4]int{2953, 2331, 1663, 1273}},
+	}
+
+	for _, tt := range tests {
+		for level, n := range tt.capacity {
+			c, err := Encode(strings.Repeat("a", n), Level(level))
+			if err != nil {
+				t.Errorf("Encode(%d bytes, %d): %v", n, level, err)
+				continue
+			}
+			if c.Version != tt.version {
+				t.Errorf("Encode(%d bytes, %d) version = %d, want %d", n, level, c.Version, tt.version)
+			}
+
+			c, err = Encode(strings.Repeat("a", n+1), Level(level))
+			if tt.version == 40 {
+				if !errors.Is(err, ErrTooLong) {
+					t.Errorf("Encode(%d bytes, %d) = %v, want ErrTooLong", n+1, level, err)
+				}
+				continue
+			}
+			if err != nil || c.Version <= tt.version {
+				t.Errorf("Encode(%d bytes, %d) = %v, want a version above %d", n+1, level, err, tt.version)
+			}
+		}
+	}
+}
+
+func TestEncodeInvalidLevel(t *testing.T) {
+	if _, err := Encode("text", High+1); err == nil {
+		t.Error("Encode with an invalid level succeeded")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	texts := []string{
+		"",
+		"https://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?type=02&bank=100000000111&sum=10000&cur=RUB",
+		"Оплата заказа №42",
+		strings.Repeat("0123456789abcdef", 40),
+	}
+
+	for _, text := range texts {
+		for level := Low; level <= High; level++ {
+			c, err := Encode(text, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := decode(c)
+			if err != nil {
+				t.Errorf("decode(%d bytes, %d): %v", len(text), level, err)
+				continue
+			}
+			if got != text {
+				t.Errorf("decode(%d bytes, %d) = %q, want %q", len(text), level, got, text)
+			}
+		}
+	}
+}
+
+// decode reads the text back from the modules of the code, the way
+// a scanner does, relying on nothing but the version.
+func decode(c *Code) (string, error) {
+	// Format information around the top left finder.
+	var format int
+	read := func(x, y, i int) {
+		if c.Black(x, y) {
+			format |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(8, i, i)
+	}
+	read(8, 7, 6)
+	read(8, 8, 7)
+	read(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(14-i, 8, i)
+	}
+
+	var level Level
+	found := false
+	for l := Low; l <= High; l++ {
+		if formatLevel[l] == (format^0x5412)>>13 {
+			level, found = l, true
+		}
+	}
+	mask := (format ^ 0x5412) >> 10 & 7
+	if !found || formatBits(level, mask) != format {
+		return "", fmt.Errorf("invalid format information %015b", format)
+	}
+
+	// Version information next to the bottom left finder.
+	if c.Version >= 7 {
+		var version int
+		for i := 0; i < 18; i++ {
+			if c.Black(i/3, c.Size-11+i%3) {
+				version |= 1 << i
+			}
+		}
+		if version != versionBits(c.Version) {
+			return "", fmt.Errorf("invalid version information %018b", version)
+		}
+	}
+
+	// Function modules of the version.
+	fn := &Code{Version: c.Version, Size: c.Version*4 + 17}
+	fn.modules = make([]bool, fn.Size*fn.Size)
+	fn.isFunction = make([]bool, fn.Size*fn.Size)
+	fn.drawFunctionPatterns()
+
+	// Codewords in the zigzag order, unmasked.
+	raw := rawModules(c.Version) / 8
+	codewords := make([]byte, raw)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if fn.isFunction[y*c.Size+x] || i >= raw*8 {
+					continue
+				}
+				if c.Black(x, y) != masks[mask](x, y) {
+					codewords[i>>3] |= 1 << (7 - i&7)
+				}
+				i++
+			}
+		}
+	}
+
+	// Blocks, deinterleaved.
+	numBlocks := eccBlocks[level][c.Version]
+	eccLen := eccPerBlock[level][c.Version]
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			// Short blocks lack the last data codeword.
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		// The block is a multiple of the generator, so its syndromes,
+		// values at the generator's roots, are zero.
+		root := byte(1)
+		for s := 0; s < eccLen; s++ {
+			var syndrome byte
+			for _, b := range block {
+				syndrome = gfMul(syndrome, root) ^ b
+			}
+			if syndrome != 0 {
+				return "", fmt.Errorf("block %d: syndrome %d is %d", j, s, syndrome)
+			}
+			root = gfMul(root, 0x02)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// Byte mode segment.
+	var bits strings.Builder
+	for _, b := range data {
+		fmt.Fprintf(&bits, "%08b", b)
+	}
+	s := bits.String()
+	if s[:4] != "0100" {
+		return "", fmt.Errorf("mode %s, want byte mode", s[:4])
+	}
+	s = s[4:]
+
+	n, _ := strconv.ParseInt(s[:countBits(c.Version)], 2, 32)
+	s = s[countBits(c.Version):]
+	if int(n)*8 > len(s) {
+		return "", fmt.Errorf("%d bytes don't fit the code", n)
+	}
+
+	text := make([]byte, n)
+	for i := range text {
+		b, _ := strconv.ParseUint(s[i*8:i*8+8], 2, 8)
+		text[i] = byte(b)
+	}
+	return string(text), nil
+}
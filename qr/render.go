@@ -0,0 +1,103 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// DefaultLevel is the error correction level of PNG and SVG,
+// which survives a screenshot or a smudged screen.
+const DefaultLevel = Medium
+
+// PNG encodes the text as a PNG image with the given pixels per module.
+func PNG(text string, scale int) ([]byte, error) {
+	c, err := Encode(text, DefaultLevel)
+	if err != nil {
+		return nil, err
+	}
+	return c.PNG(scale)
+}
+
+// SVG encodes the text as an SVG image, scaled by the viewer.
+func SVG(text string) ([]byte, error) {
+	c, err := Encode(text, DefaultLevel)
+	if err != nil {
+		return nil, err
+	}
+	return c.SVG(), nil
+}
+
+// Image returns the code with the quiet zone as a black and white
+// image with the given pixels per module.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			if c.Black(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+// PNG returns the image of the code encoded as PNG.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.WritePNG(&buf, scale); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WritePNG writes the image of the code encoded as PNG.
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	return enc.Encode(w, c.Image(scale))
+}
+
+// SVG returns the code with the quiet zone as an SVG image, one unit
+// per module. Dark modules are drawn as a single path.
+func (c *Code) SVG() []byte {
+	var buf bytes.Buffer
+	c.WriteSVG(&buf)
+	return buf.Bytes()
+}
+
+// WriteSVG writes the code as an SVG image, see SVG.
+func (c *Code) WriteSVG(w io.Writer) error {
+	side := c.Size + 2*QuietZone
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, side, side)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/>`, side, side)
+	buf.WriteString(`<path fill="#000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Black(x, y) {
+				x++
+				continue
+			}
+			// Runs of dark modules make one rectangle.
+			run := 1
+			for c.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+QuietZone, y+QuietZone, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
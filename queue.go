@@ -0,0 +1,172 @@
+package checkout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Job is a payment event waiting to be processed.
+	Job struct {
+		ID        string    `json:"id"`
+		Payment   Payment   `json:"payment"`
+		Attempts  int       `json:"attempts"`
+		NextAt    time.Time `json:"next_at"`
+		LastError string    `json:"last_error,omitempty"`
+	}
+
+	// Queue keeps jobs until they're processed.
+	Queue interface {
+		// Push adds the job, replacing the one with the same ID.
+		// The job is ready to be popped at its NextAt time. A job
+		// pushed while the one with its ID is being processed is
+		// deferred until the processing ends with Ack, Nack or Bury.
+		Push(ctx context.Context, j Job) error
+		// Pop takes the earliest ready job, so that no one else pops it
+		// until it's acknowledged. It reports false if there is none.
+		Pop(ctx context.Context) (Job, bool, error)
+		// Ack removes the processed job.
+		Ack(ctx context.Context, id string) error
+		// Nack returns the popped job to the queue to be retried
+		// at its NextAt time.
+		Nack(ctx context.Context, j Job) error
+		// Bury moves the popped job to the dead-letter list.
+		Bury(ctx context.Context, j Job) error
+		// Buried returns the dead-letter list.
+		Buried(ctx context.Context) ([]Job, error)
+	}
+)
+
+// MemoryQueue is an in-memory Queue.
+type MemoryQueue struct {
+	mu     sync.Mutex
+	jobs   map[string]Job
+	leased map[string]bool
+	dead   map[string]Job
+	// deferred are jobs pushed while being processed.
+	deferred map[string]Job
+}
+
+// NewMemoryQueue returns an empty MemoryQueue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		jobs:     make(map[string]Job),
+		leased:   make(map[string]bool),
+		dead:     make(map[string]Job),
+		deferred: make(map[string]Job),
+	}
+}
+
+// Push implements Queue.
+func (q *MemoryQueue) Push(_ context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.dead, j.ID)
+	if q.leased[j.ID] {
+		q.deferred[j.ID] = j
+		return nil
+	}
+	q.jobs[j.ID] = j
+	return nil
+}
+
+// Pop implements Queue.
+func (q *MemoryQueue) Pop(_ context.Context) (Job, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+
+	var (
+		next  Job
+		found bool
+	)
+	for id, j := range q.jobs {
+		if q.leased[id] || j.NextAt.After(now) {
+			continue
+		}
+		if !found || j.NextAt.Before(next.NextAt) {
+			next, found = j, true
+		}
+	}
+
+	if found {
+		q.leased[next.ID] = true
+	}
+	return next, found, nil
+}
+
+// Ack implements Queue.
+func (q *MemoryQueue) Ack(_ context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.jobs, id)
+	q.release(id)
+	return nil
+}
+
+// Nack implements Queue.
+func (q *MemoryQueue) Nack(_ context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.jobs[j.ID] = j
+	q.release(j.ID)
+	return nil
+}
+
+// Bury implements Queue.
+func (q *MemoryQueue) Bury(_ context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.jobs, j.ID)
+	q.release(j.ID)
+	q.dead[j.ID] = j
+	return nil
+}
+
+// release ends the processing of the job, queueing the deferred one.
+func (q *MemoryQueue) release(id string) {
+	delete(q.leased, id)
+	if j, ok := q.deferred[id]; ok {
+		delete(q.deferred, id)
+		q.jobs[id] = j
+	}
+}
+
+// isDeferred reports whether a job with the ID waits for the
+// processing of the leased one to end.
+func (q *MemoryQueue) isDeferred(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.deferred[id]
+	return ok
+}
+
+// Buried implements Queue. Jobs are sorted by ID.
+func (q *MemoryQueue) Buried(_ context.Context) ([]Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, len(q.dead))
+	for _, j := range q.dead {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].ID < jobs[k].ID
+	})
+	return jobs, nil
+}
+
+// Len returns the number of jobs waiting or being processed.
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
@@ -0,0 +1,207 @@
+package checkout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileQueue is a Queue persisted in a local directory, one file per job,
+// so that accepted events survive restarts. Jobs being processed when
+// the process stops are popped again after it restarts.
+//
+// Payment.V is not persisted. Job files that can't be decoded are
+// renamed with a .corrupt suffix when the queue is opened.
+type FileQueue struct {
+	mem *MemoryQueue
+	dir string
+
+	// mu keeps files in line with mem.
+	mu sync.Mutex
+}
+
+// OpenFileQueue opens or creates a FileQueue in the given directory.
+func OpenFileQueue(dir string) (*FileQueue, error) {
+	q := &FileQueue{mem: NewMemoryQueue(), dir: dir}
+
+	for _, sub := range []string{"jobs", "dead"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	jobs, err := q.load("jobs")
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		q.mem.jobs[j.ID] = j
+	}
+
+	dead, err := q.load("dead")
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range dead {
+		q.mem.dead[j.ID] = j
+	}
+
+	return q, nil
+}
+
+// Push implements Queue. The file of a deferred job replaces the one
+// being processed, so it's the one popped after a restart.
+func (q *FileQueue) Push(ctx context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.write("jobs", j); err != nil {
+		return err
+	}
+	if err := q.remove("dead", j.ID); err != nil {
+		return err
+	}
+	return q.mem.Push(ctx, j)
+}
+
+// Pop implements Queue.
+func (q *FileQueue) Pop(ctx context.Context) (Job, bool, error) {
+	return q.mem.Pop(ctx)
+}
+
+// Ack implements Queue.
+func (q *FileQueue) Ack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.mem.isDeferred(id) {
+		if err := q.remove("jobs", id); err != nil {
+			return err
+		}
+	}
+	return q.mem.Ack(ctx, id)
+}
+
+// Nack implements Queue.
+func (q *FileQueue) Nack(ctx context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.mem.isDeferred(j.ID) {
+		if err := q.write("jobs", j); err != nil {
+			return err
+		}
+	}
+	return q.mem.Nack(ctx, j)
+}
+
+// Bury implements Queue.
+func (q *FileQueue) Bury(ctx context.Context, j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.write("dead", j); err != nil {
+		return err
+	}
+	if !q.mem.isDeferred(j.ID) {
+		if err := q.remove("jobs", j.ID); err != nil {
+			return err
+		}
+	}
+	return q.mem.Bury(ctx, j)
+}
+
+// Buried implements Queue. Jobs are sorted by ID.
+func (q *FileQueue) Buried(ctx context.Context) ([]Job, error) {
+	return q.mem.Buried(ctx)
+}
+
+// Len returns the number of jobs waiting or being processed.
+func (q *FileQueue) Len() int {
+	return q.mem.Len()
+}
+
+func (q *FileQueue) path(sub, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(q.dir, sub, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (q *FileQueue) write(sub string, j Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	// A unique temporary file is renamed over the job's one,
+	// so a crash never leaves a partial job behind.
+	f, err := os.CreateTemp(filepath.Join(q.dir, sub), "*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, q.path(sub, j.ID)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (q *FileQueue) remove(sub, id string) error {
+	err := os.Remove(q.path(sub, id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (q *FileQueue) load(sub string) ([]Job, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(q.dir, sub, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// Undecodable files are set aside rather than dropped,
+		// so they can be recovered by hand.
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			if err := os.Rename(path, path+".corrupt"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,52 @@
+package checkout_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+)
+
+func TestFileQueueCorrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	q, err := checkout.OpenFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(ctx, checkout.Job{ID: "1", Payment: checkout.Payment{ID: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := filepath.Join(dir, "jobs", "broken.json")
+	if err := os.WriteFile(corrupt, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = checkout.OpenFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", q.Len())
+	}
+
+	if _, err := os.Stat(corrupt); !os.IsNotExist(err) {
+		t.Errorf("corrupt file is left in place: %v", err)
+	}
+	data, err := os.ReadFile(corrupt + ".corrupt")
+	if err != nil || string(data) != "{" {
+		t.Errorf("corrupt file isn't set aside: %q, %v", data, err)
+	}
+
+	// Set aside files are skipped when opened again.
+	if _, err := checkout.OpenFileQueue(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(corrupt + ".corrupt"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,366 @@
+package checkout
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type (
+	// Lister is implemented by checkouts able to list payments through
+	// the provider's API.
+	Lister interface {
+		// Payments returns the payments created within [from, to),
+		// normalized the same way as webhooks do.
+		Payments(ctx context.Context, from, to time.Time) ([]Payment, error)
+	}
+
+	// Ledger is the merchant's own record of payments.
+	Ledger interface {
+		// Payments returns the payments created within [from, to) with
+		// their Checkout, ID, Amount and Status as known locally. IDs must
+		// be the ones the providers report, e.g. in webhooks.
+		Payments(ctx context.Context, from, to time.Time) ([]Payment, error)
+	}
+)
+
+// MismatchKind is a kind of a difference between the ledger and a provider.
+type MismatchKind int
+
+// Mismatch kinds.
+const (
+	// MismatchMissing means the payment is paid at the provider,
+	// but not in the ledger, e.g. because of a missed webhook.
+	MismatchMissing MismatchKind = iota + 1
+	// MismatchAmount means the amounts differ.
+	MismatchAmount
+	// MismatchStatus means the provider reports another final status,
+	// e.g. the payment has expired or been refunded.
+	MismatchStatus
+	// MismatchUnknown means the provider reports a paid payment
+	// absent from the ledger.
+	MismatchUnknown
+	// MismatchNotFound means the payment is paid in the ledger,
+	// but the provider doesn't know it.
+	MismatchNotFound
+)
+
+var mismatchNames = map[MismatchKind]string{
+	MismatchMissing:  "missing",
+	MismatchAmount:   "amount",
+	MismatchStatus:   "status",
+	MismatchUnknown:  "unknown",
+	MismatchNotFound: "not_found",
+}
+
+func (k MismatchKind) String() string {
+	if name, ok := mismatchNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("MismatchKind(%d)", int(k))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k MismatchKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *MismatchKind) UnmarshalText(b []byte) error {
+	for kind, name := range mismatchNames {
+		if name == string(b) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("checkout: unknown mismatch kind %q", b)
+}
+
+type (
+	// Mismatch is a payment the ledger and the provider disagree on.
+	Mismatch struct {
+		Kind     MismatchKind `json:"kind"`
+		Checkout string       `json:"checkout"`
+		ID       string       `json:"id"`
+
+		// LocalStatus and LocalAmount are recorded in the ledger,
+		// Status and Amount are reported by the provider.
+		LocalStatus Status `json:"local_status"`
+		LocalAmount Money  `json:"local_amount"`
+		Status      Status `json:"status"`
+		Amount      Money  `json:"amount"`
+
+		// Recovered reports whether the callback has processed
+		// the missing payment successfully.
+		Recovered bool `json:"recovered,omitempty"`
+
+		// Payment is the payment reported by the provider.
+		Payment Payment `json:"-"`
+	}
+
+	// Failure is a checkout or a payment which couldn't be checked.
+	Failure struct {
+		Checkout string `json:"checkout"`
+		ID       string `json:"id,omitempty"` // empty if the listing failed
+		Error    string `json:"error"`
+	}
+
+	// Report is the result of a reconciliation.
+	Report struct {
+		From       time.Time  `json:"from"`
+		To         time.Time  `json:"to"`
+		Checked    int        `json:"checked"`
+		Mismatches []Mismatch `json:"mismatches"`
+		Failures   []Failure  `json:"failures,omitempty"`
+		// Skipped lists checkouts neither listing nor fetching payments.
+		Skipped []string `json:"skipped,omitempty"`
+	}
+)
+
+// WriteJSON writes the report as JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the mismatches as CSV with a header.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"kind", "checkout", "id",
+		"local_status", "local_amount", "status", "amount",
+		"recovered",
+	})
+
+	for _, m := range r.Mismatches {
+		cw.Write([]string{
+			m.Kind.String(), m.Checkout, m.ID,
+			statusField(m.LocalStatus), amountField(m.LocalAmount),
+			statusField(m.Status), amountField(m.Amount),
+			strconv.FormatBool(m.Recovered),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func statusField(s Status) string {
+	if s == StatusUnknown {
+		return ""
+	}
+	return s.String()
+}
+
+func amountField(m Money) string {
+	if m.IsZero() && m.Currency == "" {
+		return ""
+	}
+	return m.String()
+}
+
+// Reconciler compares the ledger with the payments known to providers,
+// to find the ones whose webhooks have been missed. Checkouts implementing
+// Lister are asked for all of their payments, so that unknown payments are
+// found as well. Others implementing Fetcher are asked for every payment
+// of the ledger one by one.
+//
+// Example:
+//
+//	rec := checkout.NewReconciler(ledger)
+//	rec.Handle("yookassa", yoo)
+//	rec.Handle("qiwi", qiwi)
+//	rec.Callback = callback
+//
+//	report, err := rec.Reconcile(ctx, time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour))
+type Reconciler struct {
+	Ledger Ledger
+	// Callback, if set, is called for missing payments as if their
+	// webhooks have been delivered.
+	Callback ContextCallback
+	// Logger is used to report mismatches.
+	Logger Logger
+
+	names     []string
+	checkouts map[string]Checkout
+}
+
+// NewReconciler returns a Reconciler of the ledger with no checkouts.
+func NewReconciler(l Ledger) *Reconciler {
+	return &Reconciler{Ledger: l, checkouts: make(map[string]Checkout)}
+}
+
+// Handle registers the checkout under the name used in Payment.Checkout.
+func (r *Reconciler) Handle(name string, c Checkout) {
+	if _, ok := r.checkouts[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.checkouts[name] = c
+}
+
+// Reconcile checks the payments created within [from, to). Failures of
+// providers are listed in the report, while the error is only returned
+// if the ledger fails or ctx is done.
+func (r *Reconciler) Reconcile(ctx context.Context, from, to time.Time) (Report, error) {
+	report := Report{From: from, To: to, Mismatches: []Mismatch{}}
+
+	local, err := r.Ledger.Payments(ctx, from, to)
+	if err != nil {
+		return report, err
+	}
+
+	byCheckout := make(map[string][]Payment)
+	for _, p := range local {
+		byCheckout[p.Checkout] = append(byCheckout[p.Checkout], p)
+	}
+
+	for _, name := range r.names {
+		if err := r.reconcile(ctx, &report, name, byCheckout[name]); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, report *Report, name string, local []Payment) error {
+	c := Unwrap(r.checkouts[name])
+	fetcher, canFetch := c.(Fetcher)
+
+	var (
+		listed []Payment
+		remote = make(map[string]Payment)
+	)
+
+	lister, canList := c.(Lister)
+	if canList {
+		ps, err := lister.Payments(ctx, report.From, report.To)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			report.Failures = append(report.Failures, Failure{Checkout: name, Error: err.Error()})
+			return nil
+		}
+		listed = ps
+		for _, p := range ps {
+			remote[p.ID] = p
+		}
+	} else if !canFetch {
+		report.Skipped = append(report.Skipped, name)
+		return nil
+	}
+
+	seen := make(map[string]bool, len(local))
+	for _, lp := range local {
+		seen[lp.ID] = true
+
+		rp, ok := remote[lp.ID]
+		if !ok && canFetch {
+			// Lists are bounded by the provider's creation time,
+			// which may differ from the local one.
+			p, err := fetcher.Payment(ctx, lp.ID)
+			switch {
+			case err == nil:
+				rp, ok = p, true
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case !errors.Is(err, ErrPaymentNotFound):
+				report.Failures = append(report.Failures, Failure{Checkout: name, ID: lp.ID, Error: err.Error()})
+				continue
+			}
+		}
+
+		report.Checked++
+
+		if !ok {
+			if lp.Status == StatusPaid {
+				r.add(report, Mismatch{Kind: MismatchNotFound}, lp, Payment{})
+			}
+			continue
+		}
+
+		// The callback tells checkouts apart by the name.
+		rp.Checkout = name
+		r.compare(ctx, report, lp, rp)
+	}
+
+	for _, rp := range listed {
+		if seen[rp.ID] {
+			continue
+		}
+		seen[rp.ID] = true
+		report.Checked++
+
+		// Unpaid payments, e.g. abandoned or expired, are not worth recording.
+		if paid(rp.Status) {
+			rp.Checkout = name
+			r.add(report, Mismatch{Kind: MismatchUnknown, Checkout: name}, Payment{}, rp)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reconciler) compare(ctx context.Context, report *Report, lp, rp Payment) {
+	switch {
+	case rp.Status == StatusPaid && !paid(lp.Status):
+		m := Mismatch{Kind: MismatchMissing}
+		if r.Callback != nil {
+			if err := r.Callback(ctx, rp); err != nil {
+				report.Failures = append(report.Failures, Failure{Checkout: lp.Checkout, ID: lp.ID, Error: err.Error()})
+			} else {
+				m.Recovered = true
+			}
+		}
+		r.add(report, m, lp, rp)
+	case rp.Status.Final() && rp.Status != lp.Status:
+		r.add(report, Mismatch{Kind: MismatchStatus}, lp, rp)
+	}
+
+	if !lp.Amount.IsZero() && !sameAmount(lp.Amount, rp.Amount) {
+		r.add(report, Mismatch{Kind: MismatchAmount}, lp, rp)
+	}
+}
+
+func (r *Reconciler) add(report *Report, m Mismatch, lp, rp Payment) {
+	if m.Checkout == "" {
+		m.Checkout = lp.Checkout
+	}
+	m.ID = lp.ID
+	if m.ID == "" {
+		m.ID = rp.ID
+	}
+
+	m.LocalStatus, m.LocalAmount = lp.Status, lp.Amount
+	m.Status, m.Amount = rp.Status, rp.Amount
+	m.Payment = rp
+
+	logger := r.Logger
+	if logger == nil {
+		logger = DefaultLogger
+	}
+	logger.Warn("checkout: payment mismatch", "kind", m.Kind, "checkout", m.Checkout, "id", m.ID)
+
+	report.Mismatches = append(report.Mismatches, m)
+}
+
+// paid reports whether the payment with the status has been paid,
+// even if refunded later.
+func paid(s Status) bool {
+	return s == StatusPaid || s == StatusRefunded || s == StatusPartiallyRefunded
+}
+
+// sameAmount compares the amounts, ignoring the local currency if omitted.
+func sameAmount(local, remote Money) bool {
+	if local.Currency == "" {
+		return local.Value.Equal(remote.Value)
+	}
+	return local.Equal(remote)
+}
@@ -0,0 +1,98 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotRefundable means the payment is not in a state allowing refunds.
+	ErrNotRefundable = errors.New("checkout: payment is not refundable")
+	// ErrRefundExceeded means the refund is bigger than the amount left.
+	ErrRefundExceeded = errors.New("checkout: refund exceeds refundable amount")
+)
+
+type (
+	// Refunder is implemented by checkouts able to return money to the payer.
+	Refunder interface {
+		// Refund returns the amount of the payment to the payer. A zero amount
+		// refunds everything that hasn't been refunded yet.
+		Refund(ctx context.Context, paymentID string, amount Money, reason string) (Refund, error)
+		// RefundByID returns the current state of the refund.
+		RefundByID(ctx context.Context, paymentID, refundID string) (Refund, error)
+	}
+
+	// Refund represents a universal refund object.
+	Refund struct {
+		ID        string
+		PaymentID string
+		Checkout  string
+		Amount    Money
+		Reason    string
+		CreatedAt time.Time
+
+		// Status is StatusWaiting while the refund is processed,
+		// StatusRefunded on success and StatusRejected on failure.
+		Status Status
+
+		// V stores an original refund structure.
+		V interface{} `json:"-"`
+	}
+)
+
+// RefundAmount checks a refund of the payment's amount with refunded already
+// returned. It returns the amount to refund, which is the rest of the payment
+// if the given amount is zero.
+func RefundAmount(paid, refunded, amount Money) (Money, error) {
+	left, err := paid.Sub(refunded)
+	if err != nil {
+		return Money{}, err
+	}
+	if !left.IsPositive() {
+		return Money{}, fmt.Errorf("%w: nothing left to refund", ErrRefundExceeded)
+	}
+	if amount.IsZero() {
+		return left, nil
+	}
+	if amount.IsNegative() {
+		return Money{}, fmt.Errorf("checkout: negative refund amount %s", amount)
+	}
+
+	cmp, err := amount.Cmp(left)
+	if err != nil {
+		return Money{}, err
+	}
+	if cmp > 0 {
+		return Money{}, fmt.Errorf("%w: %s left", ErrRefundExceeded, left)
+	}
+
+	return amount, nil
+}
+
+type refundKey struct{}
+
+// WithRefundKey returns the context making Refund use the key as the
+// idempotency key, e.g. to make two equal partial refunds of a payment.
+func WithRefundKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, refundKey{}, key)
+}
+
+// RefundKey returns the idempotency key of the refund, set with WithRefundKey
+// or derived from the payment ID, amount and reason otherwise, so a refund
+// repeated after a lost response isn't made twice. The key is a UUID.
+func RefundKey(ctx context.Context, paymentID string, amount Money, reason string) string {
+	if key, ok := ctx.Value(refundKey{}).(string); ok && key != "" {
+		return key
+	}
+	data := paymentID + "\x00" + amount.String() + "\x00" + reason
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(data)).String()
+}
+
+// Refundable reports whether a payment with the given status can be refunded.
+func Refundable(s Status) bool {
+	return s == StatusPaid || s == StatusPartiallyRefunded
+}
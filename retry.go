@@ -0,0 +1,100 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries temporary failures, see Temporary, with exponential
+// backoff and jitter. The zero value makes a single attempt.
+//
+// API calls are retried with the same idempotency key, so a request
+// reaching the provider more than once has a single effect.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// MinDelay is the delay before the first retry, 200ms by default.
+	// It doubles with every attempt up to MaxDelay, 10s by default.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy makes up to three attempts.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3}
+
+// Do calls fn until it succeeds, fails permanently, the attempts are over
+// or the context is done. It returns the last error of fn.
+//
+// A provider asking to retry later than MaxDelay with Retry-After
+// is not retried.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !Temporary(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay, ok := p.delay(attempt, err)
+		if !ok {
+			return err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// delay returns the delay before the next attempt, or false
+// if the provider asked to wait too long.
+func (p RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	minDelay, maxDelay := p.MinDelay, p.MaxDelay
+	if minDelay <= 0 {
+		minDelay = 200 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 10 * time.Second
+	}
+
+	var perr *ProviderError
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		return perr.RetryAfter, perr.RetryAfter <= maxDelay
+	}
+
+	d := minDelay
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+
+	// Equal jitter: half of the delay is random.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// RetryAfter returns the delay the response asks to wait with
+// the Retry-After header, or zero if there is none.
+func RetryAfter(resp *http.Response) time.Duration {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+)
+
+// ErrNoRoute means no rule of a Router matches the payment.
+var ErrNoRoute = errors.New("checkout: no route")
+
+type (
+	// Rule selects payments by their fields. Zero fields match any payment.
+	Rule struct {
+		// Currencies lists currencies of the amount.
+		Currencies []string
+		// MinAmount and MaxAmount bound the amount inclusively. A bound
+		// doesn't match amounts of another currency.
+		MinAmount Money
+		MaxAmount Money
+		// PaymentMethods lists values of Payment.PaymentMethod.
+		PaymentMethods []string
+		// Metadata lists values the payment's metadata must have,
+		// compared as strings.
+		Metadata map[string]string
+		// Match is an additional custom condition.
+		Match func(Payment) bool
+	}
+
+	// Target is a checkout a rule routes payments to.
+	Target struct {
+		Name string
+		// Weight is the target's share among the rule's targets.
+		// Zero is treated as one.
+		Weight int
+	}
+
+	// Link is a payment link built by a Router.
+	Link struct {
+		Checkout string // name of the chosen checkout
+		URL      string
+	}
+)
+
+// Matches reports whether the payment satisfies the rule.
+func (r Rule) Matches(p Payment) bool {
+	if len(r.Currencies) > 0 && !contains(r.Currencies, p.Amount.Currency) {
+		return false
+	}
+	if !r.MinAmount.IsZero() {
+		if cmp, err := p.Amount.Cmp(r.MinAmount); err != nil || cmp < 0 {
+			return false
+		}
+	}
+	if !r.MaxAmount.IsZero() {
+		if cmp, err := p.Amount.Cmp(r.MaxAmount); err != nil || cmp > 0 {
+			return false
+		}
+	}
+	if len(r.PaymentMethods) > 0 && !contains(r.PaymentMethods, p.PaymentMethod) {
+		return false
+	}
+	for k, v := range r.Metadata {
+		mv, ok := p.Metadata[k]
+		if !ok || fmt.Sprint(mv) != v {
+			return false
+		}
+	}
+	return r.Match == nil || r.Match(p)
+}
+
+// Router is a Checkout delegating every payment to one of several
+// checkouts, chosen by the first matching rule. Webhooks are routed
+// back to the delegates the same way as by Mux.
+//
+// Example:
+//
+//	router := checkout.NewRouter()
+//	router.Handle("yookassa", yoo)
+//	router.Handle("yoomoney", yoomoney)
+//	router.Handle("payeer", payeer)
+//
+//	router.AddRule(checkout.Rule{MaxAmount: checkout.MustParseMoney("100", checkout.RUB)},
+//		checkout.Target{Name: "yoomoney"})
+//	router.AddRule(checkout.Rule{Currencies: []string{checkout.RUB}},
+//		checkout.Target{Name: "yookassa", Weight: 9}, checkout.Target{Name: "payeer", Weight: 1})
+//	router.AddRule(checkout.Rule{}, checkout.Target{Name: "payeer"})
+//
+// A Router must be configured before it's used.
+type Router struct {
+	// Logger is used by webhooks to report unrouted requests.
+	Logger Logger
+
+	names     []string
+	delegates map[string]Checkout
+	rules     []routerRule
+}
+
+type routerRule struct {
+	rule    Rule
+	targets []Target
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return &Router{delegates: make(map[string]Checkout)}
+}
+
+// Handle registers the checkout under the given name.
+func (r *Router) Handle(name string, c Checkout) {
+	if _, ok := r.delegates[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.delegates[name] = c
+}
+
+// Checkout returns the checkout registered under the given name.
+func (r *Router) Checkout(name string) (Checkout, bool) {
+	c, ok := r.delegates[name]
+	return c, ok
+}
+
+// AddRule routes payments matching the rule to one of the targets,
+// split by their weights. Rules are tried in the order they're added.
+func (r *Router) AddRule(rule Rule, targets ...Target) {
+	r.rules = append(r.rules, routerRule{rule: rule, targets: targets})
+}
+
+// Select returns the name of the checkout the payment is routed to.
+// The choice among weighted targets depends on the payment ID only,
+// so the same payment is always routed the same way.
+func (r *Router) Select(p Payment) (string, error) {
+	for _, rr := range r.rules {
+		if len(rr.targets) == 0 || !rr.rule.Matches(p) {
+			continue
+		}
+
+		name := pick(rr.targets, p.ID)
+		if _, ok := r.delegates[name]; !ok {
+			return "", fmt.Errorf("checkout: router has no checkout %q", name)
+		}
+		return name, nil
+	}
+	return "", ErrNoRoute
+}
+
+// Link builds the payment link with the chosen checkout.
+func (r *Router) Link(ctx context.Context, p Payment) (Link, error) {
+	name, err := r.Select(p)
+	if err != nil {
+		return Link{}, err
+	}
+
+	url, err := RequestContext(ctx, r.delegates[name], p)
+	if err != nil {
+		return Link{}, err
+	}
+	return Link{Checkout: name, URL: url}, nil
+}
+
+func (r *Router) Request(p Payment) (string, error) {
+	return r.RequestContext(context.Background(), p)
+}
+
+// RequestContext implements ContextCheckout.
+func (r *Router) RequestContext(ctx context.Context, p Payment) (string, error) {
+	link, err := r.Link(ctx, p)
+	return link.URL, err
+}
+
+func (r *Router) Webhook(callback Callback) http.Handler {
+	return r.WebhookContext(WithoutContext(callback))
+}
+
+// WebhookContext implements ContextCheckout. The returned handler is
+// a Mux of the delegates, so Payment.Checkout is set to the name of
+// the checkout the webhook came from.
+func (r *Router) WebhookContext(callback ContextCallback) http.Handler {
+	mux := NewMux(callback)
+	mux.Logger = r.Logger
+	for _, name := range r.names {
+		mux.Handle(name, r.delegates[name])
+	}
+	return mux
+}
+
+// pick chooses one of the targets by their weights, using the key
+// as a source of randomness.
+func pick(targets []Target, key string) string {
+	total := 0
+	for _, t := range targets {
+		total += weight(t)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	n := int(h.Sum32() % uint32(total))
+
+	for _, t := range targets {
+		if n -= weight(t); n < 0 {
+			return t.Name
+		}
+	}
+	return targets[len(targets)-1].Name
+}
+
+func weight(t Target) int {
+	if t.Weight <= 0 {
+		return 1
+	}
+	return t.Weight
+}
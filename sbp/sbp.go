@@ -0,0 +1,155 @@
+// Package sbp handles payment links of the Faster Payments System (SBP),
+// returned by providers for payments with the "sbp" method. A link opens
+// the list of banks on a phone, or a deep link opens the payer's bank app
+// right away:
+//
+//	link, err := sbp.Parse(payload)
+//	link.DeepLink("bank100000000111") // bank100000000111://qr.nspk.ru/AD10...
+package sbp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.massbots.xyz/checkout"
+)
+
+// MembersURL lists banks supporting SBP payments with their app schemas.
+const MembersURL = "https://qr.nspk.ru/proxyapp/c2bmembers.json"
+
+// ErrInvalidLink means the text is not an SBP payment link.
+var ErrInvalidLink = errors.New("sbp: invalid link")
+
+// Link types.
+const (
+	Static  = "01" // reusable, the amount may be entered by the payer
+	Dynamic = "02" // issued for a single payment
+)
+
+// hosts are the hosts of SBP payment and subscription links.
+var hosts = map[string]bool{
+	"qr.nspk.ru":  true,
+	"sub.nspk.ru": true,
+}
+
+type (
+	// Link is an SBP payment link, e.g.
+	// https://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?type=02&bank=100000000111&sum=10000&cur=RUB
+	Link struct {
+		ID     string
+		Type   string
+		BankID string // the recipient's bank
+		// Amount is zero if the link lacks one.
+		Amount checkout.Money
+
+		url *url.URL
+	}
+
+	// Bank is a bank supporting SBP payments.
+	Bank struct {
+		Name        string `json:"bankName"`
+		LogoURL     string `json:"logoURL"`
+		Schema      string `json:"schema"`
+		PackageName string `json:"package_name"`
+	}
+)
+
+// IsLink reports whether the text is an SBP payment link.
+func IsLink(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+// Parse parses the SBP payment link. The amount is given in kopecks.
+func Parse(s string) (Link, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return Link{}, fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || !hosts[strings.ToLower(u.Host)] {
+		return Link{}, fmt.Errorf("%w: %s", ErrInvalidLink, s)
+	}
+
+	id := strings.Trim(u.Path, "/")
+	if id == "" || strings.Contains(id, "/") {
+		return Link{}, fmt.Errorf("%w: no payment ID in %s", ErrInvalidLink, s)
+	}
+
+	q := u.Query()
+	link := Link{
+		ID:     id,
+		Type:   q.Get("type"),
+		BankID: q.Get("bank"),
+		url:    u,
+	}
+
+	if sum := q.Get("sum"); sum != "" {
+		kopecks, err := strconv.ParseInt(sum, 10, 64)
+		if err != nil {
+			return Link{}, fmt.Errorf("%w: invalid sum %q", ErrInvalidLink, sum)
+		}
+		currency := q.Get("cur")
+		if currency == "" {
+			currency = checkout.RUB
+		}
+		link.Amount = checkout.FromMinor(kopecks, currency)
+	}
+
+	return link, nil
+}
+
+// String returns the link as is.
+func (l Link) String() string {
+	if l.url == nil {
+		return ""
+	}
+	return l.url.String()
+}
+
+// DeepLink returns the link opening the app of the bank with the schema,
+// e.g. "bank100000000111", listed by Banks.
+func (l Link) DeepLink(schema string) string {
+	if l.url == nil || schema == "" {
+		return ""
+	}
+	u := *l.url
+	u.Scheme = schema
+	return u.String()
+}
+
+// Banks fetches the banks supporting SBP payments from MembersURL.
+// The client defaults to http.DefaultClient.
+func Banks(ctx context.Context, client *http.Client) ([]Bank, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, MembersURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sbp: banks responded with %s", resp.Status)
+	}
+
+	var result struct {
+		Dictionary []Bank `json:"dictionary"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Dictionary, nil
+}
@@ -0,0 +1,91 @@
+package sbp_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/sbp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		link   string
+		id     string
+		typ    string
+		bank   string
+		amount checkout.Money
+	}{
+		{
+			"https://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?type=02&bank=100000000111&sum=10000&cur=RUB",
+			"AD10006M8KH7F6SR8H5P9O5CL9EF1VPN", sbp.Dynamic, "100000000111", checkout.MustParseMoney("100", checkout.RUB),
+		},
+		{
+			" https://QR.NSPK.RU/BS1A0054EC7LHSDI9NBA3GUJKAG7P56J/?type=01&bank=100000000008 ",
+			"BS1A0054EC7LHSDI9NBA3GUJKAG7P56J", sbp.Static, "100000000008", checkout.Money{},
+		},
+		{
+			"https://sub.nspk.ru/SD1000ABCDEFGHIJ?type=02&sum=199",
+			"SD1000ABCDEFGHIJ", sbp.Dynamic, "", checkout.MustParseMoney("1.99", checkout.RUB),
+		},
+	}
+
+	for _, tt := range tests {
+		link, err := sbp.Parse(tt.link)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.link, err)
+			continue
+		}
+		if link.ID != tt.id || link.Type != tt.typ || link.BankID != tt.bank || !link.Amount.Equal(tt.amount) {
+			t.Errorf("Parse(%q) = %+v", tt.link, link)
+		}
+		if !sbp.IsLink(tt.link) {
+			t.Errorf("IsLink(%q) = false", tt.link)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	links := []string{
+		"",
+		"AD10006M8KH7F6SR8H5P9O5CL9EF1VPN",
+		"https://example.com/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN",
+		"ftp://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN",
+		"https://qr.nspk.ru/",
+		"https://qr.nspk.ru/AD10/extra",
+		"https://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?sum=100.00",
+		"https://qr.nspk.ru/%zz",
+	}
+
+	for _, s := range links {
+		if _, err := sbp.Parse(s); !errors.Is(err, sbp.ErrInvalidLink) {
+			t.Errorf("Parse(%q) = %v, want ErrInvalidLink", s, err)
+		}
+		if sbp.IsLink(s) {
+			t.Errorf("IsLink(%q) = true", s)
+		}
+	}
+}
+
+func TestDeepLink(t *testing.T) {
+	s := "https://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?type=02&bank=100000000111&sum=10000&cur=RUB"
+
+	link, err := sbp.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.String() != s {
+		t.Errorf("String = %q, want %q", link.String(), s)
+	}
+
+	want := "bank100000000111://qr.nspk.ru/AD10006M8KH7F6SR8H5P9O5CL9EF1VPN?type=02&bank=100000000111&sum=10000&cur=RUB"
+	if got := link.DeepLink("bank100000000111"); got != want {
+		t.Errorf("DeepLink = %q, want %q", got, want)
+	}
+	if got := link.DeepLink(""); got != "" {
+		t.Errorf("DeepLink without a schema = %q, want none", got)
+	}
+	if got := (sbp.Link{}).DeepLink("bank100000000111"); got != "" {
+		t.Errorf("DeepLink of a zero link = %q, want none", got)
+	}
+}
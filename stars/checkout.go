@@ -0,0 +1,390 @@
+// Package stars sells digital goods for Telegram Stars.
+//
+// Stars invoices are created and paid the same way as ones of Telegram
+// Payments, so the checkout is built on top of telegram.Checkout, with
+// XTR amounts in whole stars and no payment provider.
+package stars
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/telegram"
+)
+
+// Period is the only subscription period supported by Telegram.
+const Period = 30 * 24 * time.Hour
+
+type (
+	// Checkout implements checkout.Checkout with Telegram Stars.
+	Checkout struct {
+		// Token is the bot's token.
+		Token string
+		// Title is the product name shown in invoices, 1-32 characters.
+		Title string
+		// SecretToken is the secret_token the webhook is set with.
+		SecretToken string
+		Logger      checkout.Logger
+
+		// PreCheckout and Next are the same as of telegram.Checkout.
+		PreCheckout checkout.ContextCallback
+		Next        http.Handler
+
+		// Period makes invoices subscriptions charged every period,
+		// which must be Period. Invoices are one-time if it's zero.
+		Period time.Duration
+
+		// Client and BaseURL default to http.DefaultClient and telegram.BaseURL.
+		Client  *http.Client
+		BaseURL string
+
+		// Retry is the policy of retrying API calls, none by default.
+		Retry checkout.RetryPolicy
+	}
+
+	// Transaction is a Telegram Stars transaction of the bot.
+	Transaction struct {
+		ID     string `json:"id"`
+		Amount int64  `json:"amount"`
+		Date   int64  `json:"date"`
+		// Source is set for incoming transactions, e.g. payments,
+		// and Receiver for outgoing ones, e.g. refunds.
+		Source   *Partner `json:"source,omitempty"`
+		Receiver *Partner `json:"receiver,omitempty"`
+	}
+
+	// Partner is the other side of a transaction.
+	Partner struct {
+		Type               string         `json:"type"`
+		User               *telegram.User `json:"user,omitempty"`
+		InvoicePayload     string         `json:"invoice_payload,omitempty"`
+		SubscriptionPeriod int            `json:"subscription_period,omitempty"`
+	}
+)
+
+// Bot returns the Telegram Payments checkout the payments are processed
+// with, e.g. to call other Bot API methods.
+func (c Checkout) Bot() telegram.Checkout {
+	return telegram.Checkout{
+		Name:        "stars",
+		Token:       c.Token,
+		Title:       c.Title,
+		SecretToken: c.SecretToken,
+		Logger:      c.Logger,
+		PreCheckout: c.PreCheckout,
+		Next:        c.Next,
+		Client:      c.Client,
+		BaseURL:     c.BaseURL,
+		Retry:       c.Retry,
+	}
+}
+
+// Charge returns the charge of the successful payment, which is the payment
+// ID refunds are made with. It's empty if the payment lacks the payer or
+// the telegram_payment_charge_id.
+func Charge(payment checkout.Payment) string {
+	chargeID, _ := payment.Metadata["telegram_payment_charge_id"].(string)
+	userID, ok := int64Of(payment.Metadata["user_id"])
+	if m := telegram.From(payment); m.SuccessfulPayment != nil {
+		chargeID = m.SuccessfulPayment.TelegramPaymentChargeID
+		if m.From != nil {
+			userID, ok = m.From.ID, true
+		}
+	}
+
+	if chargeID == "" || !ok {
+		return ""
+	}
+	return strconv.FormatInt(userID, 10) + ":" + chargeID
+}
+
+// parseCharge splits the charge into the user ID and the charge ID.
+func parseCharge(charge string) (int64, string, error) {
+	user, chargeID, ok := strings.Cut(charge, ":")
+	if !ok || chargeID == "" {
+		return 0, "", fmt.Errorf("stars: invalid charge %q, want user_id:charge_id", charge)
+	}
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("stars: invalid charge %q: %v", charge, err)
+	}
+	return userID, chargeID, nil
+}
+
+// int64Of converts a metadata value to int64, which is decoded
+// as float64 or json.Number once the payment is stored as JSON.
+func int64Of(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "stars",
+		Refunds:    true,
+		Fields:     []string{"Comment"},
+		Currencies: []string{checkout.XTR},
+		MinAmount:  checkout.FromMinor(1, checkout.XTR),
+		MaxAmount:  checkout.FromMinor(10000, checkout.XTR),
+		MaxComment: 255,
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	if err := c.Capabilities().Validate(p); err != nil {
+		return err
+	}
+	if len(p.ID) > 128 {
+		return &checkout.ValidationError{
+			Checkout: "stars",
+			Field:    "ID",
+			Reason:   "is longer than 128 bytes",
+		}
+	}
+	return nil
+}
+
+func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext creates an invoice link for the amount in stars.
+// The payment ID is sent as the invoice payload.
+func (c Checkout) RequestContext(ctx context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+	if c.Period != 0 && c.Period != Period {
+		return "", fmt.Errorf("stars: subscription period must be %s, not %s", Period, c.Period)
+	}
+
+	description := payment.Comment
+	if description == "" {
+		description = c.Title
+	}
+
+	return c.Bot().CreateInvoiceLink(ctx, telegram.Invoice{
+		Title:       c.Title,
+		Description: description,
+		Payload:     payment.ID,
+		Currency:    checkout.XTR,
+		Prices: []telegram.LabeledPrice{
+			{Label: c.Title, Amount: payment.Amount.Minor()},
+		},
+		SubscriptionPeriod: int(c.Period / time.Second),
+	})
+}
+
+func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.Bot().Webhook(callback)
+}
+
+// WebhookContext returns the bot's webhook handler, see
+// telegram.Checkout.WebhookContext.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
+	return c.Bot().WebhookContext(callback)
+}
+
+// Process handles the update received by other means, e.g. long polling.
+func (c Checkout) Process(ctx context.Context, u telegram.Update, callback checkout.ContextCallback) (bool, error) {
+	return c.Bot().Process(ctx, u, callback)
+}
+
+// Parse implements checkout.Parser, see telegram.Checkout.Parse.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	return c.Bot().Parse(r)
+}
+
+// Refund implements checkout.Refunder. The payment ID is the charge of
+// the payment returned by Charge. Stars are refunded in full only, so
+// the amount must be zero, and the refunded amount is looked up in the
+// bot's transactions.
+//
+// refundStarPayment isn't idempotent: a retried call whose first attempt
+// succeeded is answered with CHARGE_ALREADY_REFUNDED, which is then
+// taken as the success of the refund.
+func (c Checkout) Refund(ctx context.Context, paymentID string, amount checkout.Money, reason string) (checkout.Refund, error) {
+	if !amount.IsZero() {
+		return checkout.Refund{}, errors.New("stars: partial refunds are not supported")
+	}
+
+	userID, chargeID, err := parseCharge(paymentID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	charged, ok, err := c.transaction(ctx, func(tx Transaction) bool {
+		return tx.ID == chargeID && tx.Source != nil && tx.Source.Type == "user"
+	})
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if !ok {
+		return checkout.Refund{}, fmt.Errorf("%w: charge %s", checkout.ErrPaymentNotFound, chargeID)
+	}
+
+	req := struct {
+		UserID   int64  `json:"user_id"`
+		ChargeID string `json:"telegram_payment_charge_id"`
+	}{userID, chargeID}
+
+	// Attempts are retried here, so that a refund made by a lost
+	// attempt is told apart from one made before.
+	bot := c.Bot()
+	bot.Retry = checkout.RetryPolicy{}
+
+	attempted := false
+	err = c.Retry.Do(ctx, func() error {
+		err := bot.Call(ctx, "refundStarPayment", req, nil)
+		if attempted && alreadyRefunded(err) {
+			return nil
+		}
+		attempted = true
+		return err
+	})
+	if err != nil {
+		if alreadyRefunded(err) {
+			return checkout.Refund{}, fmt.Errorf("%w: %v", checkout.ErrNotRefundable, err)
+		}
+		return checkout.Refund{}, err
+	}
+
+	return checkout.Refund{
+		ID:        chargeID,
+		PaymentID: paymentID,
+		Checkout:  "stars",
+		Amount:    checkout.FromMinor(charged.Amount, checkout.XTR),
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+		Status:    checkout.StatusRefunded,
+	}, nil
+}
+
+// alreadyRefunded reports whether the error is CHARGE_ALREADY_REFUNDED.
+func alreadyRefunded(err error) bool {
+	var perr *checkout.ProviderError
+	return errors.As(err, &perr) && strings.Contains(perr.Message, "CHARGE_ALREADY_REFUNDED")
+}
+
+// RefundByID implements checkout.Refunder. The refund ID is the charge ID
+// of the payment, and the refund is looked up in the bot's transactions.
+func (c Checkout) RefundByID(ctx context.Context, paymentID, refundID string) (checkout.Refund, error) {
+	if refundID == "" {
+		_, chargeID, err := parseCharge(paymentID)
+		if err != nil {
+			return checkout.Refund{}, err
+		}
+		refundID = chargeID
+	}
+
+	// Refunds have the ID of the refunded payment.
+	tx, ok, err := c.transaction(ctx, func(tx Transaction) bool {
+		return tx.ID == refundID && tx.Receiver != nil && tx.Receiver.Type == "user"
+	})
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if !ok {
+		return checkout.Refund{}, fmt.Errorf("%w: refund %s", checkout.ErrPaymentNotFound, refundID)
+	}
+
+	return checkout.Refund{
+		ID:        tx.ID,
+		PaymentID: paymentID,
+		Checkout:  "stars",
+		Amount:    checkout.FromMinor(tx.Amount, checkout.XTR),
+		CreatedAt: time.Unix(tx.Date, 0).UTC(),
+		Status:    checkout.StatusRefunded,
+		V:         tx,
+	}, nil
+}
+
+// transaction returns the first of the bot's transactions matching,
+// reporting false if there is none.
+func (c Checkout) transaction(ctx context.Context, match func(Transaction) bool) (Transaction, bool, error) {
+	const limit = 100
+	for offset := 0; ; offset += limit {
+		txs, err := c.Transactions(ctx, offset, limit)
+		if err != nil {
+			return Transaction{}, false, err
+		}
+
+		for _, tx := range txs {
+			if match(tx) {
+				return tx, true, nil
+			}
+		}
+
+		if len(txs) < limit {
+			return Transaction{}, false, nil
+		}
+	}
+}
+
+// Transactions calls getStarTransactions.
+func (c Checkout) Transactions(ctx context.Context, offset, limit int) ([]Transaction, error) {
+	req := struct {
+		Offset int `json:"offset,omitempty"`
+		Limit  int `json:"limit,omitempty"`
+	}{offset, limit}
+
+	var result struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+	if err := c.Bot().Call(ctx, "getStarTransactions", req, &result); err != nil {
+		return nil, err
+	}
+	return result.Transactions, nil
+}
+
+// CancelSubscription calls editUserStarSubscription, canceling or
+// restoring the extension of the user's subscription paid with the charge.
+func (c Checkout) CancelSubscription(ctx context.Context, charge string, cancel bool) error {
+	userID, chargeID, err := parseCharge(charge)
+	if err != nil {
+		return err
+	}
+
+	req := struct {
+		UserID     int64  `json:"user_id"`
+		ChargeID   string `json:"telegram_payment_charge_id"`
+		IsCanceled bool   `json:"is_canceled"`
+	}{userID, chargeID, cancel}
+
+	return c.Bot().Call(ctx, "editUserStarSubscription", req, nil)
+}
+
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return c.Bot().Networks()
+}
+
+// Detect implements checkout.Detector. Stars and Telegram Payments
+// updates can't be told apart, so a bot should use one of them.
+func (c Checkout) Detect(r *http.Request) bool {
+	return c.Bot().Detect(r)
+}
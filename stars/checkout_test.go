@@ -0,0 +1,191 @@
+package stars_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/stars"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/telegram/telegramtest"
+)
+
+var user = telegram.User{ID: 42, FirstName: "Test"}
+
+// pay requests the payment with the checkout and pays it,
+// returning the charge of the notified payment.
+func pay(t *testing.T, srv *telegramtest.Server, co stars.Checkout, payment checkout.Payment) string {
+	t.Helper()
+
+	var got []checkout.Payment
+	srv.Webhook = co.Webhook(func(p checkout.Payment) error {
+		got = append(got, p)
+		return nil
+	})
+
+	link, err := co.Request(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Pay(link, user); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d payments, want 1", len(got))
+	}
+
+	p := got[0]
+	if p.ID != payment.ID || p.Status != checkout.StatusPaid || !p.Amount.Equal(payment.Amount) {
+		t.Errorf("payment = %+v", p)
+	}
+	return stars.Charge(p)
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Stars()
+	charge := pay(t, srv, co, checkout.Payment{ID: "order-1", Amount: checkout.FromMinor(50, checkout.XTR)})
+
+	userID, chargeID, _ := strings.Cut(charge, ":")
+	if userID != "42" || chargeID == "" {
+		t.Fatalf("charge = %q, want the user and the charge ID", charge)
+	}
+
+	if _, err := co.Refund(ctx, charge, checkout.FromMinor(10, checkout.XTR), ""); err == nil {
+		t.Error("partial Refund succeeded")
+	}
+
+	refund, err := co.Refund(ctx, charge, checkout.Money{}, "canceled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.ID != chargeID || refund.Status != checkout.StatusRefunded || !refund.Amount.Equal(checkout.FromMinor(50, checkout.XTR)) {
+		t.Errorf("Refund = %+v", refund)
+	}
+	if c, _ := srv.Charge(chargeID); !c.Refunded {
+		t.Error("charge isn't refunded")
+	}
+
+	if _, err := co.Refund(ctx, charge, checkout.Money{}, ""); !errors.Is(err, checkout.ErrNotRefundable) {
+		t.Errorf("repeated Refund = %v, want ErrNotRefundable", err)
+	}
+
+	byID, err := co.RefundByID(ctx, charge, "")
+	if err != nil || byID.ID != chargeID || !byID.Amount.Equal(checkout.FromMinor(50, checkout.XTR)) {
+		t.Errorf("RefundByID = %+v, %v", byID, err)
+	}
+
+	if _, err := co.RefundByID(ctx, charge, "missing"); !errors.Is(err, checkout.ErrPaymentNotFound) {
+		t.Errorf("RefundByID of a missing refund = %v, want ErrPaymentNotFound", err)
+	}
+
+	if _, err := co.Refund(ctx, "invalid", checkout.Money{}, ""); err == nil {
+		t.Error("Refund of an invalid charge succeeded")
+	}
+	if _, err := co.Refund(ctx, "42:missing", checkout.Money{}, ""); !errors.Is(err, checkout.ErrPaymentNotFound) {
+		t.Errorf("Refund of a missing charge = %v, want ErrPaymentNotFound", err)
+	}
+}
+
+// lossy loses the response of the first call of the method.
+type lossy struct {
+	method string
+	next   http.RoundTripper
+	lost   bool
+}
+
+func (l *lossy) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := l.next.RoundTrip(r)
+	if err != nil || l.lost || !strings.HasSuffix(r.URL.Path, "/"+l.method) {
+		return resp, err
+	}
+	resp.Body.Close()
+	l.lost = true
+	return nil, io.ErrUnexpectedEOF
+}
+
+func TestRefundRetry(t *testing.T) {
+	ctx := context.Background()
+
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Stars()
+	charge := pay(t, srv, co, checkout.Payment{ID: "1", Amount: checkout.FromMinor(50, checkout.XTR)})
+
+	co.Client = &http.Client{Transport: &lossy{method: "refundStarPayment", next: srv.Client().Transport}}
+	co.Retry = checkout.RetryPolicy{Attempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	// The lost attempt has refunded the charge.
+	refund, err := co.Refund(ctx, charge, checkout.Money{}, "")
+	if err != nil || !refund.Amount.Equal(checkout.FromMinor(50, checkout.XTR)) {
+		t.Errorf("Refund with a lost response = %+v, %v", refund, err)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Stars()
+	pay(t, srv, co, checkout.Payment{ID: "1", Amount: checkout.FromMinor(10, checkout.XTR)})
+	pay(t, srv, co, checkout.Payment{ID: "2", Amount: checkout.FromMinor(20, checkout.XTR)})
+
+	txs, err := co.Transactions(ctx, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 || txs[0].Amount != 10 || txs[1].Amount != 20 {
+		t.Errorf("Transactions = %+v", txs)
+	}
+	if src := txs[1].Source; src == nil || src.InvoicePayload != "2" || src.User == nil || src.User.ID != 42 {
+		t.Errorf("transaction source = %+v", src)
+	}
+
+	txs, err = co.Transactions(ctx, 1, 100)
+	if err != nil || len(txs) != 1 {
+		t.Errorf("Transactions from 1 = %+v, %v", txs, err)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	ctx := context.Background()
+
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Stars()
+	co.Period = stars.Period
+	charge := pay(t, srv, co, checkout.Payment{ID: "1", Amount: checkout.FromMinor(100, checkout.XTR)})
+	_, chargeID, _ := strings.Cut(charge, ":")
+
+	if err := co.CancelSubscription(ctx, charge, true); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := srv.Charge(chargeID); !c.Canceled {
+		t.Error("subscription isn't canceled")
+	}
+
+	if err := co.CancelSubscription(ctx, charge, false); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := srv.Charge(chargeID); c.Canceled {
+		t.Error("subscription isn't restored")
+	}
+
+	co.Period = stars.Period / 2
+	if _, err := co.Request(checkout.Payment{ID: "2", Amount: checkout.FromMinor(100, checkout.XTR)}); err == nil {
+		t.Error("Request with an unsupported period succeeded")
+	}
+}
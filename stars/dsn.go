@@ -0,0 +1,35 @@
+package stars
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("stars", open)
+}
+
+// open builds a checkout from the configuration. The bot token
+// contains a colon, so it's split into the user and the password.
+// DSN: stars://123456:ABC-DEF@?title=...&secret_token=...&subscription=1&retry=3
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		Title:       cfg.Get("title"),
+		SecretToken: cfg.Get("secret_token"),
+		BaseURL:     cfg.Get("base_url"),
+	}
+	if cfg.User != "" && cfg.Password != "" {
+		c.Token = cfg.User + ":" + cfg.Password
+	}
+	if cfg.Bool("subscription") {
+		c.Period = Period
+	}
+
+	retry, err := cfg.Int("retry")
+	if err != nil {
+		return nil, err
+	}
+	c.Retry.Attempts = retry
+
+	if err := cfg.Require("token", c.Token, "title", c.Title); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,79 @@
+package checkout
+
+import "fmt"
+
+// Status is a normalized payment status.
+type Status int
+
+// Statuses.
+const (
+	// StatusUnknown means the provider reported a status this package
+	// doesn't recognize.
+	StatusUnknown Status = iota
+	StatusPaid
+	StatusWaiting
+	StatusExpired
+	StatusRejected
+	// StatusCanceled means the payment was canceled by the merchant.
+	StatusCanceled
+	// StatusWaitingForCapture means the funds are held and wait
+	// to be captured or voided by the merchant.
+	StatusWaitingForCapture
+	StatusRefunded
+	StatusPartiallyRefunded
+)
+
+var statusNames = map[Status]string{
+	StatusUnknown:           "unknown",
+	StatusPaid:              "paid",
+	StatusWaiting:           "waiting",
+	StatusExpired:           "expired",
+	StatusRejected:          "rejected",
+	StatusCanceled:          "canceled",
+	StatusWaitingForCapture: "waiting_for_capture",
+	StatusRefunded:          "refunded",
+	StatusPartiallyRefunded: "partially_refunded",
+}
+
+// ParseStatus returns the status with the given name.
+func ParseStatus(s string) (Status, error) {
+	for st, name := range statusNames {
+		if name == s {
+			return st, nil
+		}
+	}
+	return StatusUnknown, fmt.Errorf("checkout: unknown status %q", s)
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Final reports whether the payment can't leave the status by itself,
+// i.e. without a refund or any other merchant's action.
+func (s Status) Final() bool {
+	switch s {
+	case StatusPaid, StatusExpired, StatusRejected, StatusCanceled,
+		StatusRefunded, StatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Status) UnmarshalText(b []byte) error {
+	st, err := ParseStatus(string(b))
+	if err != nil {
+		return err
+	}
+	*s = st
+	return nil
+}
@@ -0,0 +1,56 @@
+package checkout_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.massbots.xyz/checkout"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		status checkout.Status
+		name   string
+		final  bool
+	}{
+		{checkout.StatusUnknown, "unknown", false},
+		{checkout.StatusPaid, "paid", true},
+		{checkout.StatusWaiting, "waiting", false},
+		{checkout.StatusExpired, "expired", true},
+		{checkout.StatusRejected, "rejected", true},
+		{checkout.StatusCanceled, "canceled", true},
+		{checkout.StatusWaitingForCapture, "waiting_for_capture", false},
+		{checkout.StatusRefunded, "refunded", true},
+		{checkout.StatusPartiallyRefunded, "partially_refunded", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.String(); got != tt.name {
+			t.Errorf("Status(%d).String() = %q, want %q", int(tt.status), got, tt.name)
+		}
+		if got := tt.status.Final(); got != tt.final {
+			t.Errorf("%s.Final() = %v, want %v", tt.status, got, tt.final)
+		}
+
+		parsed, err := checkout.ParseStatus(tt.name)
+		if err != nil || parsed != tt.status {
+			t.Errorf("ParseStatus(%q) = %s, %v, want %s", tt.name, parsed, err, tt.status)
+		}
+
+		data, err := json.Marshal(tt.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back checkout.Status
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.status {
+			t.Errorf("JSON round trip of %s = %s, %v", tt.status, back, err)
+		}
+	}
+
+	if _, err := checkout.ParseStatus("settled"); err == nil {
+		t.Error("ParseStatus(settled) succeeded, want error")
+	}
+	if got := checkout.Status(100).String(); got != "Status(100)" {
+		t.Errorf("Status(100).String() = %q", got)
+	}
+}
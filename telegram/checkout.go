@@ -0,0 +1,539 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+const BaseURL = "https://api.telegram.org"
+
+// SecretTokenHeader carries the secret token set with setWebhook.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+type (
+	// Checkout implements checkout.Checkout with Telegram Payments.
+	// Payment links are invoice links created by the bot, and the webhook
+	// is the bot's webhook receiving its updates.
+	Checkout struct {
+		// Name is the checkout name of payments and errors,
+		// "telegram" by default.
+		Name string
+
+		// Token is the bot's token.
+		Token string
+		// ProviderToken is the payment provider token issued by @BotFather.
+		ProviderToken string
+		// Title is the product name shown in invoices, 1-32 characters.
+		Title string
+		// SecretToken is the secret_token the webhook is set with.
+		SecretToken string
+		Logger      checkout.Logger
+
+		// PreCheckout is called to confirm the order before the payment.
+		// It gets the payment with StatusWaiting, and declines the order
+		// by returning an error. Orders are confirmed if it's nil.
+		PreCheckout checkout.ContextCallback
+		// Next serves updates other than payments, which are
+		// acknowledged if it's nil.
+		Next http.Handler
+
+		// Client and BaseURL default to http.DefaultClient and BaseURL.
+		Client  *http.Client
+		BaseURL string
+
+		// Retry is the policy of retrying API calls, none by default.
+		Retry checkout.RetryPolicy
+	}
+
+	User struct {
+		ID           int64  `json:"id"`
+		IsBot        bool   `json:"is_bot"`
+		FirstName    string `json:"first_name"`
+		LastName     string `json:"last_name,omitempty"`
+		Username     string `json:"username,omitempty"`
+		LanguageCode string `json:"language_code,omitempty"`
+	}
+
+	Chat struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	}
+
+	Update struct {
+		UpdateID         int               `json:"update_id"`
+		Message          *Message          `json:"message,omitempty"`
+		PreCheckoutQuery *PreCheckoutQuery `json:"pre_checkout_query,omitempty"`
+	}
+
+	Message struct {
+		MessageID         int                `json:"message_id"`
+		From              *User              `json:"from,omitempty"`
+		Chat              Chat               `json:"chat"`
+		Date              int64              `json:"date"`
+		SuccessfulPayment *SuccessfulPayment `json:"successful_payment,omitempty"`
+	}
+
+	OrderInfo struct {
+		Name        string `json:"name,omitempty"`
+		PhoneNumber string `json:"phone_number,omitempty"`
+		Email       string `json:"email,omitempty"`
+	}
+
+	PreCheckoutQuery struct {
+		ID               string     `json:"id"`
+		From             User       `json:"from"`
+		Currency         string     `json:"currency"`
+		TotalAmount      int64      `json:"total_amount"`
+		InvoicePayload   string     `json:"invoice_payload"`
+		ShippingOptionID string     `json:"shipping_option_id,omitempty"`
+		OrderInfo        *OrderInfo `json:"order_info,omitempty"`
+	}
+
+	SuccessfulPayment struct {
+		Currency                   string     `json:"currency"`
+		TotalAmount                int64      `json:"total_amount"`
+		InvoicePayload             string     `json:"invoice_payload"`
+		SubscriptionExpirationDate int64      `json:"subscription_expiration_date,omitempty"`
+		IsRecurring                bool       `json:"is_recurring,omitempty"`
+		IsFirstRecurring           bool       `json:"is_first_recurring,omitempty"`
+		ShippingOptionID           string     `json:"shipping_option_id,omitempty"`
+		OrderInfo                  *OrderInfo `json:"order_info,omitempty"`
+		TelegramPaymentChargeID    string     `json:"telegram_payment_charge_id"`
+		ProviderPaymentChargeID    string     `json:"provider_payment_charge_id"`
+	}
+
+	LabeledPrice struct {
+		Label  string `json:"label"`
+		Amount int64  `json:"amount"`
+	}
+
+	// Invoice holds parameters of createInvoiceLink.
+	Invoice struct {
+		Title              string         `json:"title"`
+		Description        string         `json:"description"`
+		Payload            string         `json:"payload"`
+		ProviderToken      string         `json:"provider_token,omitempty"`
+		Currency           string         `json:"currency"`
+		Prices             []LabeledPrice `json:"prices"`
+		SubscriptionPeriod int            `json:"subscription_period,omitempty"`
+	}
+)
+
+// networks are published at https://core.telegram.org/bots/webhooks.
+var networks = checkout.MustParseNetworks(
+	"149.154.160.0/20",
+	"91.108.4.0/22",
+)
+
+// From returns the original message of the successful payment.
+func From(payment checkout.Payment) Message {
+	m, _ := payment.V.(Message)
+	return m
+}
+
+// Query returns the pre-checkout query of the payment passed to PreCheckout.
+func Query(payment checkout.Payment) PreCheckoutQuery {
+	q, _ := payment.V.(PreCheckoutQuery)
+	return q
+}
+
+// Decline returns an error declining the order in PreCheckout with the
+// message shown to the user. Other errors are shown as a generic message.
+func Decline(message string) error {
+	return &declineError{message: message}
+}
+
+type declineError struct {
+	message string
+}
+
+func (e *declineError) Error() string {
+	return "telegram: order declined: " + e.message
+}
+
+func (c Checkout) name() string {
+	if c.Name == "" {
+		return "telegram"
+	}
+	return c.Name
+}
+
+// defaultDecline is shown to the user if PreCheckout fails.
+const defaultDecline = "The order can't be processed now, please try again later."
+
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout: c.name(),
+		Fields:   []string{"Comment"},
+		Currencies: []string{
+			checkout.RUB, checkout.UAH, checkout.USD, checkout.EUR,
+			checkout.KZT, checkout.BYN, checkout.UZS, checkout.GBP,
+			checkout.CNY, checkout.TRY, checkout.AZN, checkout.GEL,
+		},
+		MaxComment: 255,
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	if err := c.Capabilities().Validate(p); err != nil {
+		return err
+	}
+	return validatePayload(c.Capabilities().Checkout, p.ID)
+}
+
+// validatePayload checks the payment ID fits the invoice payload.
+func validatePayload(name, id string) error {
+	if len(id) > 128 {
+		return &checkout.ValidationError{
+			Checkout: name,
+			Field:    "ID",
+			Reason:   "is longer than 128 bytes",
+		}
+	}
+	return nil
+}
+
+func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext creates an invoice link. The payment ID is sent
+// as the invoice payload.
+func (c Checkout) RequestContext(ctx context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
+	description := payment.Comment
+	if description == "" {
+		description = c.Title
+	}
+
+	return c.CreateInvoiceLink(ctx, Invoice{
+		Title:         c.Title,
+		Description:   description,
+		Payload:       payment.ID,
+		ProviderToken: c.ProviderToken,
+		Currency:      payment.Amount.Currency,
+		Prices: []LabeledPrice{
+			{Label: c.Title, Amount: payment.Amount.Minor()},
+		},
+	})
+}
+
+// CreateInvoiceLink calls createInvoiceLink and returns the link.
+func (c Checkout) CreateInvoiceLink(ctx context.Context, inv Invoice) (string, error) {
+	var link string
+	if err := c.Call(ctx, "createInvoiceLink", inv, &link); err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// AnswerPreCheckoutQuery calls answerPreCheckoutQuery. The error
+// message is shown to the user if the order is declined.
+func (c Checkout) AnswerPreCheckoutQuery(ctx context.Context, id string, ok bool, errorMessage string) error {
+	req := struct {
+		ID           string `json:"pre_checkout_query_id"`
+		OK           bool   `json:"ok"`
+		ErrorMessage string `json:"error_message,omitempty"`
+	}{id, ok, errorMessage}
+
+	return c.Call(ctx, "answerPreCheckoutQuery", req, nil)
+}
+
+// Call calls the Bot API method with the given parameters, decoding
+// the result into v unless it's nil. Temporary failures are retried
+// according to the retry policy.
+func (c Checkout) Call(ctx context.Context, method string, params, v any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.Retry.Do(ctx, func() error {
+		return c.attempt(ctx, method, data, v)
+	})
+}
+
+func (c Checkout) attempt(ctx context.Context, method string, data []byte, v any) error {
+	base := c.BaseURL
+	if base == "" {
+		base = BaseURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/bot"+c.Token+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return c.redact(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return c.redact(err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return &checkout.ProviderError{Checkout: c.name(), StatusCode: resp.StatusCode}
+		}
+		return err
+	}
+
+	if !result.OK {
+		code := result.ErrorCode
+		if code == 0 {
+			code = resp.StatusCode
+		}
+		return &checkout.ProviderError{
+			Checkout:   c.name(),
+			StatusCode: code,
+			Message:    result.Description,
+			RetryAfter: time.Duration(result.Parameters.RetryAfter) * time.Second,
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, v)
+}
+
+// redact removes the token from the URL of the request error,
+// so that it doesn't end up in logs.
+func (c Checkout) redact(err error) error {
+	var uerr *url.Error
+	if c.Token != "" && errors.As(err, &uerr) {
+		uerr.URL = strings.ReplaceAll(uerr.URL, c.Token, "<token>")
+	}
+	return err
+}
+
+func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
+
+// WebhookContext returns the bot's webhook handler. It answers
+// pre-checkout queries and calls the callback for successful payments.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		update, body, err := c.parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, c.name(), err)
+			return
+		}
+
+		ok, err := c.Process(r.Context(), update, callback)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, c.name(), err)
+			return
+		}
+
+		if !ok && c.Next != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			c.Next.ServeHTTP(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// Process handles the update received by other means, e.g. long polling.
+// It reports whether the update is a pre-checkout query or a successful
+// payment.
+func (c Checkout) Process(ctx context.Context, u Update, callback checkout.ContextCallback) (bool, error) {
+	switch {
+	case u.PreCheckoutQuery != nil:
+		return true, c.preCheckout(ctx, *u.PreCheckoutQuery)
+	case u.Message != nil && u.Message.SuccessfulPayment != nil:
+		payment, err := c.normalize(*u.Message)
+		if err != nil {
+			return true, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+		}
+		return true, callback(ctx, payment)
+	}
+	return false, nil
+}
+
+func (c Checkout) preCheckout(ctx context.Context, q PreCheckoutQuery) error {
+	if c.PreCheckout == nil {
+		return c.AnswerPreCheckoutQuery(ctx, q.ID, true, "")
+	}
+
+	payment, err := c.normalizeQuery(q)
+	if err != nil {
+		return fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if err := c.PreCheckout(ctx, payment); err != nil {
+		var decline *declineError
+		message := defaultDecline
+		if errors.As(err, &decline) {
+			message = decline.message
+		} else {
+			logger := c.Logger
+			if logger == nil {
+				logger = checkout.DefaultLogger
+			}
+			logger.Error("checkout: pre-checkout failed", "checkout", c.name(), "id", payment.ID, "error", err)
+		}
+		return c.AnswerPreCheckoutQuery(ctx, q.ID, false, message)
+	}
+
+	return c.AnswerPreCheckoutQuery(ctx, q.ID, true, "")
+}
+
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return networks
+}
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	if c.SecretToken != "" {
+		return c.authorized(r)
+	}
+
+	var u struct {
+		UpdateID *int `json:"update_id"`
+	}
+	return json.NewDecoder(r.Body).Decode(&u) == nil && u.UpdateID != nil
+}
+
+func (c Checkout) authorized(r *http.Request) bool {
+	token := r.Header.Get(SecretTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.SecretToken)) == 1
+}
+
+// Parse implements checkout.Parser. Pre-checkout queries are returned
+// with StatusWaiting, and are neither answered nor passed to PreCheckout.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	u, _, err := c.parse(r)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	var payment checkout.Payment
+	switch {
+	case u.PreCheckoutQuery != nil:
+		payment, err = c.normalizeQuery(*u.PreCheckoutQuery)
+	case u.Message != nil && u.Message.SuccessfulPayment != nil:
+		payment, err = c.normalize(*u.Message)
+	default:
+		return checkout.Payment{}, fmt.Errorf("%w: update %d has no payment", checkout.ErrMalformedPayload, u.UpdateID)
+	}
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+	return payment, nil
+}
+
+func (c Checkout) parse(r *http.Request) (Update, []byte, error) {
+	if c.SecretToken != "" && !c.authorized(r) {
+		return Update{}, nil, checkout.ErrBadSignature
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Update{}, nil, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	var u Update
+	if err := json.Unmarshal(body, &u); err != nil {
+		return Update{}, nil, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	return u, body, nil
+}
+
+// normalize converts the message with a successful payment into
+// checkout.Payment. Charge IDs, the payer and the subscription, if any,
+// are kept in Metadata.
+func (c Checkout) normalize(m Message) (checkout.Payment, error) {
+	sp := m.SuccessfulPayment
+
+	amount, err := money(sp.TotalAmount, sp.Currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	metadata := checkout.Metadata{
+		"telegram_payment_charge_id": sp.TelegramPaymentChargeID,
+		"provider_payment_charge_id": sp.ProviderPaymentChargeID,
+		"chat_id":                    m.Chat.ID,
+	}
+	if m.From != nil {
+		metadata["user_id"] = m.From.ID
+	}
+	if sp.SubscriptionExpirationDate != 0 {
+		metadata["subscription_expiration_date"] = sp.SubscriptionExpirationDate
+		metadata["is_recurring"] = sp.IsRecurring
+	}
+
+	return checkout.Payment{
+		Checkout: c.name(),
+		ID:       sp.InvoicePayload,
+		Amount:   amount,
+		Metadata: metadata,
+		Status:   checkout.StatusPaid,
+		PaidAt:   time.Unix(m.Date, 0).UTC(),
+		V:        m,
+	}, nil
+}
+
+// normalizeQuery converts the pre-checkout query into checkout.Payment
+// waiting to be paid.
+func (c Checkout) normalizeQuery(q PreCheckoutQuery) (checkout.Payment, error) {
+	amount, err := money(q.TotalAmount, q.Currency)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	return checkout.Payment{
+		Checkout: c.name(),
+		ID:       q.InvoicePayload,
+		Amount:   amount,
+		Metadata: checkout.Metadata{"user_id": q.From.ID},
+		Status:   checkout.StatusWaiting,
+		V:        q,
+	}, nil
+}
+
+// money converts the amount in minor units of a known currency.
+func money(amount int64, currency string) (checkout.Money, error) {
+	if _, ok := checkout.LookupCurrency(currency); !ok {
+		return checkout.Money{}, fmt.Errorf("%w: %s", checkout.ErrUnknownCurrency, currency)
+	}
+	return checkout.FromMinor(amount, currency), nil
+}
@@ -0,0 +1,177 @@
+package telegram_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/telegram"
+	"go.massbots.xyz/checkout/telegram/telegramtest"
+)
+
+var user = telegram.User{ID: 42, FirstName: "Test"}
+
+func TestPaymentRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+	srv.SecretToken = "secret"
+
+	co := srv.Checkout()
+
+	var queries []checkout.Payment
+	co.PreCheckout = func(_ context.Context, p checkout.Payment) error {
+		queries = append(queries, p)
+		return nil
+	}
+
+	var got []checkout.Payment
+	srv.Webhook = co.WebhookContext(func(_ context.Context, p checkout.Payment) error {
+		got = append(got, p)
+		return nil
+	})
+
+	link, err := co.RequestContext(ctx, checkout.Payment{
+		ID:      "order-1",
+		Amount:  checkout.MustParseMoney("100.50", checkout.RUB),
+		Comment: "Premium",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != srv.LastLink() {
+		t.Errorf("link = %q, want %q", link, srv.LastLink())
+	}
+
+	inv, _ := srv.Invoice(link)
+	if inv.Payload != "order-1" || inv.Description != "Premium" || inv.Prices[0].Amount != 10050 {
+		t.Errorf("invoice = %+v", inv)
+	}
+
+	if _, err := srv.Pay(link, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queries) != 1 || queries[0].Status != checkout.StatusWaiting || queries[0].ID != "order-1" {
+		t.Errorf("pre-checkout queries = %+v", queries)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d payments, want 1", len(got))
+	}
+	p := got[0]
+	if p.ID != "order-1" || p.Status != checkout.StatusPaid ||
+		!p.Amount.Equal(checkout.MustParseMoney("100.50", checkout.RUB)) {
+		t.Errorf("payment = %+v", p)
+	}
+	if m := telegram.From(p); m.From == nil || m.From.ID != user.ID {
+		t.Errorf("payment from %+v, want the user", m.From)
+	}
+
+	for _, d := range srv.Deliveries() {
+		if d.StatusCode != http.StatusOK {
+			t.Errorf("update %d answered with %d", d.Update.UpdateID, d.StatusCode)
+		}
+	}
+}
+
+func TestDecline(t *testing.T) {
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	co.PreCheckout = func(context.Context, checkout.Payment) error {
+		return telegram.Decline("Out of stock")
+	}
+
+	called := false
+	srv.Webhook = co.Webhook(func(checkout.Payment) error {
+		called = true
+		return nil
+	})
+
+	link, err := co.Request(checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("10", checkout.USD)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = srv.Pay(link, user)
+	if !errors.Is(err, telegramtest.ErrDeclined) {
+		t.Errorf("Pay = %v, want ErrDeclined", err)
+	}
+	if called {
+		t.Error("callback called for a declined order")
+	}
+}
+
+func TestSecretToken(t *testing.T) {
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+	srv.SecretToken = "secret"
+
+	co := srv.Checkout()
+	co.SecretToken = "other"
+
+	called := false
+	srv.Webhook = co.Webhook(func(checkout.Payment) error {
+		called = true
+		return nil
+	})
+
+	code := srv.Notify(telegram.Update{Message: &telegram.Message{
+		SuccessfulPayment: &telegram.SuccessfulPayment{
+			Currency:       checkout.RUB,
+			TotalAmount:    100,
+			InvoicePayload: "1",
+		},
+	}})
+	if code == http.StatusOK || called {
+		t.Errorf("update with a wrong secret token answered with %d, callback called: %v", code, called)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := telegramtest.NewServer("1:token")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	co.Retry = checkout.RetryPolicy{Attempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	srv.Fail(telegramtest.Error{StatusCode: http.StatusBadGateway, Description: "Bad Gateway"})
+	srv.Fail(telegramtest.Error{StatusCode: http.StatusInternalServerError, Description: "Internal Server Error"})
+
+	payment := checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("10", checkout.USD)}
+	if _, err := co.Request(payment); err != nil {
+		t.Fatalf("Request after temporary failures: %v", err)
+	}
+
+	srv.Fail(telegramtest.Error{StatusCode: http.StatusBadRequest, Description: "Bad Request: invalid currency"})
+	srv.Fail(telegramtest.Error{StatusCode: http.StatusBadGateway, Description: "Bad Gateway"})
+
+	_, err := co.Request(payment)
+	var perr *checkout.ProviderError
+	if !errors.As(err, &perr) || perr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Request = %v, want the bad request unretried", err)
+	}
+}
+
+func TestTokenRedacted(t *testing.T) {
+	srv := telegramtest.NewServer("1:secret-token")
+	co := srv.Checkout()
+	srv.Close()
+
+	_, err := co.Request(checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("10", checkout.USD)})
+	if err == nil {
+		t.Fatal("Request to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error reveals the token: %v", err)
+	}
+	if !checkout.Temporary(err) {
+		t.Errorf("Temporary(%v) = false, want a connection failure", err)
+	}
+}
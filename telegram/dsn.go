@@ -0,0 +1,33 @@
+package telegram
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("telegram", open)
+}
+
+// open builds a checkout from the configuration. The bot token
+// contains a colon, so it's split into the user and the password.
+// DSN: telegram://123456:ABC-DEF@?provider_token=...&title=...&secret_token=...&retry=3
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		ProviderToken: cfg.Get("provider_token"),
+		Title:         cfg.Get("title"),
+		SecretToken:   cfg.Get("secret_token"),
+		BaseURL:       cfg.Get("base_url"),
+	}
+	if cfg.User != "" && cfg.Password != "" {
+		c.Token = cfg.User + ":" + cfg.Password
+	}
+
+	retry, err := cfg.Int("retry")
+	if err != nil {
+		return nil, err
+	}
+	c.Retry.Attempts = retry
+
+	if err := cfg.Require("token", c.Token, "provider token", c.ProviderToken, "title", c.Title); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
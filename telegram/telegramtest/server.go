@@ -0,0 +1,513 @@
+// Package telegramtest provides a fake Telegram Bot API for tests.
+//
+// The server keeps invoice links in memory and sends payment updates
+// to the configured webhook, the same way Telegram does when a user pays:
+//
+//	srv := telegramtest.NewServer("123:token")
+//	defer srv.Close()
+//
+//	co := srv.Checkout()
+//	srv.Webhook = co.Webhook(callback)
+//
+//	link, _ := co.Request(payment)
+//	srv.Pay(link, user) // pre-checkout query, then the successful payment
+//
+// Stars invoices are paid the same way, and their charges are kept
+// for refunds and transactions.
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/stars"
+	"go.massbots.xyz/checkout/telegram"
+)
+
+// ErrDeclined means the bot has declined the pre-checkout query.
+var ErrDeclined = errors.New("telegramtest: order declined")
+
+// Server is a fake Telegram Bot API.
+type Server struct {
+	*httptest.Server
+
+	Token string
+	// SecretToken is sent with every update, if it's set.
+	SecretToken string
+
+	// Webhook receives updates, if it's set.
+	Webhook http.Handler
+
+	mu         sync.Mutex
+	invoices   map[string]telegram.Invoice
+	queries    map[string]bool
+	answers    map[string]Answer
+	failures   []Error
+	deliveries []Delivery
+	charges    map[string]*Charge
+	txs        []stars.Transaction
+	last       string
+	seq        int
+}
+
+type (
+	// Error is an error response of the API.
+	Error struct {
+		StatusCode  int
+		Description string
+
+		// RetryAfter is sent as parameters.retry_after, unless zero.
+		RetryAfter time.Duration
+	}
+
+	// Answer is the bot's answer to a pre-checkout query.
+	Answer struct {
+		OK           bool
+		ErrorMessage string
+	}
+
+	// Charge is a paid Stars invoice.
+	Charge struct {
+		UserID   int64
+		Amount   int64
+		Payload  string
+		Refunded bool
+		// Canceled means the subscription won't be extended.
+		Canceled bool
+	}
+
+	// Delivery is an update sent to the webhook.
+	Delivery struct {
+		Update     telegram.Update
+		StatusCode int
+	}
+)
+
+// NewServer starts a fake API of the bot with the given token.
+// The caller should call Close when finished.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:    token,
+		invoices: make(map[string]telegram.Invoice),
+		queries:  make(map[string]bool),
+		answers:  make(map[string]Answer),
+		charges:  make(map[string]*Charge),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Checkout returns a checkout pointed at the server.
+func (s *Server) Checkout() telegram.Checkout {
+	return telegram.Checkout{
+		Token:         s.Token,
+		ProviderToken: "TEST",
+		Title:         "Test",
+		SecretToken:   s.SecretToken,
+		Client:        s.Client(),
+		BaseURL:       s.URL,
+	}
+}
+
+// Stars returns a Stars checkout pointed at the server.
+func (s *Server) Stars() stars.Checkout {
+	return stars.Checkout{
+		Token:       s.Token,
+		Title:       "Test",
+		SecretToken: s.SecretToken,
+		Client:      s.Client(),
+		BaseURL:     s.URL,
+	}
+}
+
+// Charge returns the Stars charge with the telegram_payment_charge_id.
+func (s *Server) Charge(id string) (Charge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.charges[id]
+	if !ok {
+		return Charge{}, false
+	}
+	return *c, true
+}
+
+// Invoice returns the invoice of the link.
+func (s *Server) Invoice(link string) (telegram.Invoice, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invoices[link]
+	return inv, ok
+}
+
+// LastLink returns the last created invoice link.
+func (s *Server) LastLink() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Deliveries returns the updates sent to the webhook so far.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// Fail makes the next API call answer with the error.
+// Calls fail in the order errors were added.
+func (s *Server) Fail(e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, e)
+}
+
+// Pay simulates the user paying the invoice of the link. It sends
+// a pre-checkout query and, once the bot confirms it, a message with
+// the successful payment, which is returned.
+func (s *Server) Pay(link string, from telegram.User) (telegram.Message, error) {
+	s.mu.Lock()
+	inv, ok := s.invoices[link]
+	if !ok {
+		s.mu.Unlock()
+		return telegram.Message{}, fmt.Errorf("telegramtest: unknown invoice link %s", link)
+	}
+	s.seq++
+	queryID := strconv.Itoa(s.seq)
+	s.queries[queryID] = true
+	s.mu.Unlock()
+
+	var total int64
+	for _, p := range inv.Prices {
+		total += p.Amount
+	}
+
+	s.Notify(telegram.Update{PreCheckoutQuery: &telegram.PreCheckoutQuery{
+		ID:             queryID,
+		From:           from,
+		Currency:       inv.Currency,
+		TotalAmount:    total,
+		InvoicePayload: inv.Payload,
+	}})
+
+	s.mu.Lock()
+	answer, ok := s.answers[queryID]
+	s.seq++
+	n := s.seq
+	s.mu.Unlock()
+
+	if !ok {
+		return telegram.Message{}, errors.New("telegramtest: pre-checkout query is not answered")
+	}
+	if !answer.OK {
+		return telegram.Message{}, fmt.Errorf("%w: %s", ErrDeclined, answer.ErrorMessage)
+	}
+
+	now := time.Now()
+	sp := &telegram.SuccessfulPayment{
+		Currency:                inv.Currency,
+		TotalAmount:             total,
+		InvoicePayload:          inv.Payload,
+		TelegramPaymentChargeID: "tg-" + strconv.Itoa(n),
+	}
+	if inv.SubscriptionPeriod > 0 {
+		sp.SubscriptionExpirationDate = now.Add(time.Duration(inv.SubscriptionPeriod) * time.Second).Unix()
+		sp.IsRecurring = true
+		sp.IsFirstRecurring = true
+	}
+
+	if inv.Currency == checkout.XTR {
+		s.mu.Lock()
+		s.charges[sp.TelegramPaymentChargeID] = &Charge{UserID: from.ID, Amount: total, Payload: inv.Payload}
+		s.txs = append(s.txs, stars.Transaction{
+			ID:     sp.TelegramPaymentChargeID,
+			Amount: total,
+			Date:   now.Unix(),
+			Source: &stars.Partner{
+				Type:               "user",
+				User:               &from,
+				InvoicePayload:     inv.Payload,
+				SubscriptionPeriod: inv.SubscriptionPeriod,
+			},
+		})
+		s.mu.Unlock()
+	} else {
+		sp.ProviderPaymentChargeID = "provider-" + strconv.Itoa(n)
+	}
+
+	m := telegram.Message{
+		MessageID:         n,
+		From:              &from,
+		Chat:              telegram.Chat{ID: from.ID, Type: "private"},
+		Date:              now.Unix(),
+		SuccessfulPayment: sp,
+	}
+
+	if code := s.Notify(telegram.Update{Message: &m}); code != 0 && code != http.StatusOK {
+		return m, fmt.Errorf("telegramtest: webhook responded with %d", code)
+	}
+	return m, nil
+}
+
+// Notify sends the update to the webhook and returns its status code.
+// A zero update ID is assigned the next one.
+func (s *Server) Notify(u telegram.Update) int {
+	if s.Webhook == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	if u.UpdateID == 0 {
+		s.seq++
+		u.UpdateID = s.seq
+	}
+	s.mu.Unlock()
+
+	data, _ := json.Marshal(u)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+	if s.SecretToken != "" {
+		r.Header.Set(telegram.SecretTokenHeader, s.SecretToken)
+	}
+
+	w := httptest.NewRecorder()
+	s.Webhook.ServeHTTP(w, r)
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, Delivery{Update: u, StatusCode: w.Code})
+	s.mu.Unlock()
+
+	return w.Code
+}
+
+// result is a response of the API.
+type result struct {
+	OK          bool   `json:"ok"`
+	Result      any    `json:"result,omitempty"`
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters,omitempty"`
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+
+	status, v := s.handle(r, body.Bytes())
+
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *Server) handle(r *http.Request, body []byte) (int, result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/bot") {
+		return s.errorResponse(Error{StatusCode: http.StatusNotFound, Description: "Not Found"})
+	}
+	if token != s.Token {
+		return s.errorResponse(Error{StatusCode: http.StatusUnauthorized, Description: "Unauthorized"})
+	}
+
+	if len(s.failures) > 0 {
+		e := s.failures[0]
+		s.failures = s.failures[1:]
+		return s.errorResponse(e)
+	}
+
+	switch method {
+	case "createInvoiceLink":
+		return s.createInvoiceLink(body)
+	case "answerPreCheckoutQuery":
+		return s.answerPreCheckoutQuery(body)
+	case "refundStarPayment":
+		return s.refundStarPayment(body)
+	case "getStarTransactions":
+		return s.getStarTransactions(body)
+	case "editUserStarSubscription":
+		return s.editUserStarSubscription(body)
+	}
+
+	return s.errorResponse(Error{StatusCode: http.StatusNotFound, Description: "Not Found: method not found"})
+}
+
+func (s *Server) createInvoiceLink(body []byte) (int, result) {
+	var inv telegram.Invoice
+	if err := json.Unmarshal(body, &inv); err != nil {
+		return s.badRequest(err.Error())
+	}
+
+	switch {
+	case !between(inv.Title, 1, 32):
+		return s.badRequest("invoice title length must be between 1 and 32")
+	case !between(inv.Description, 1, 255):
+		return s.badRequest("invoice description length must be between 1 and 255")
+	case len(inv.Payload) < 1 || len(inv.Payload) > 128:
+		return s.badRequest("invoice payload length must be between 1 and 128 bytes")
+	case inv.Currency == "":
+		return s.badRequest("invalid currency")
+	case len(inv.Prices) == 0:
+		return s.badRequest("prices must be non-empty")
+	}
+	for _, p := range inv.Prices {
+		if p.Amount <= 0 {
+			return s.badRequest("CURRENCY_TOTAL_AMOUNT_INVALID")
+		}
+	}
+
+	if inv.Currency == checkout.XTR {
+		switch {
+		case inv.ProviderToken != "":
+			return s.badRequest("provider_token must be empty for payments in Telegram Stars")
+		case len(inv.Prices) != 1:
+			return s.badRequest("exactly one price must be specified for payments in Telegram Stars")
+		case inv.Prices[0].Amount > 10000:
+			return s.badRequest("CURRENCY_TOTAL_AMOUNT_INVALID")
+		case inv.SubscriptionPeriod != 0 && inv.SubscriptionPeriod != 2592000:
+			return s.badRequest("SUBSCRIPTION_PERIOD_INVALID")
+		}
+	} else {
+		switch {
+		case inv.ProviderToken == "":
+			return s.badRequest("PAYMENT_PROVIDER_INVALID")
+		case inv.SubscriptionPeriod != 0:
+			return s.badRequest("subscriptions are supported only for payments in Telegram Stars")
+		}
+	}
+
+	s.seq++
+	link := "https://t.me/$test" + strconv.Itoa(s.seq)
+	s.invoices[link] = inv
+	s.last = link
+
+	return http.StatusOK, result{OK: true, Result: link}
+}
+
+func (s *Server) answerPreCheckoutQuery(body []byte) (int, result) {
+	var req struct {
+		ID           string `json:"pre_checkout_query_id"`
+		OK           bool   `json:"ok"`
+		ErrorMessage string `json:"error_message"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.badRequest(err.Error())
+	}
+	if !s.queries[req.ID] {
+		return s.badRequest("query is too old and response timeout expired or query ID is invalid")
+	}
+	if !req.OK && req.ErrorMessage == "" {
+		return s.badRequest("error message must be non-empty")
+	}
+
+	delete(s.queries, req.ID)
+	s.answers[req.ID] = Answer{OK: req.OK, ErrorMessage: req.ErrorMessage}
+	return http.StatusOK, result{OK: true, Result: true}
+}
+
+func (s *Server) refundStarPayment(body []byte) (int, result) {
+	var req struct {
+		UserID   int64  `json:"user_id"`
+		ChargeID string `json:"telegram_payment_charge_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.badRequest(err.Error())
+	}
+
+	c, ok := s.charges[req.ChargeID]
+	switch {
+	case !ok || c.UserID != req.UserID:
+		return s.badRequest("CHARGE_NOT_FOUND")
+	case c.Refunded:
+		return s.badRequest("CHARGE_ALREADY_REFUNDED")
+	}
+
+	c.Refunded = true
+	s.txs = append(s.txs, stars.Transaction{
+		ID:       req.ChargeID,
+		Amount:   c.Amount,
+		Date:     time.Now().Unix(),
+		Receiver: &stars.Partner{Type: "user", User: &telegram.User{ID: c.UserID}},
+	})
+	return http.StatusOK, result{OK: true, Result: true}
+}
+
+func (s *Server) getStarTransactions(body []byte) (int, result) {
+	var req struct {
+		Offset int `json:"offset"`
+		Limit  int `json:"limit"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.badRequest(err.Error())
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 100
+	}
+
+	txs := []stars.Transaction{}
+	if req.Offset < len(s.txs) {
+		txs = s.txs[req.Offset:]
+	}
+	if len(txs) > req.Limit {
+		txs = txs[:req.Limit]
+	}
+
+	return http.StatusOK, result{OK: true, Result: map[string]any{"transactions": txs}}
+}
+
+func (s *Server) editUserStarSubscription(body []byte) (int, result) {
+	var req struct {
+		UserID     int64  `json:"user_id"`
+		ChargeID   string `json:"telegram_payment_charge_id"`
+		IsCanceled bool   `json:"is_canceled"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.badRequest(err.Error())
+	}
+
+	c, ok := s.charges[req.ChargeID]
+	if !ok || c.UserID != req.UserID {
+		return s.badRequest("CHARGE_NOT_FOUND")
+	}
+
+	c.Canceled = req.IsCanceled
+	return http.StatusOK, result{OK: true, Result: true}
+}
+
+func (s *Server) badRequest(description string) (int, result) {
+	return s.errorResponse(Error{
+		StatusCode:  http.StatusBadRequest,
+		Description: "Bad Request: " + description,
+	})
+}
+
+func (s *Server) errorResponse(e Error) (int, result) {
+	res := result{ErrorCode: e.StatusCode, Description: e.Description}
+	if e.RetryAfter > 0 {
+		res.Parameters = &struct {
+			RetryAfter int `json:"retry_after"`
+		}{int(e.RetryAfter.Seconds())}
+	}
+	return e.StatusCode, res
+}
+
+func between(s string, min, max int) bool {
+	n := utf8.RuneCountInString(s)
+	return n >= min && n <= max
+}
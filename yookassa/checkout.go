@@ -2,22 +2,42 @@ package yookassa
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"go.massbots.xyz/checkout"
 )
 
-const BaseURL = "https://api.yookassa.ru/v3/payments"
+const (
+	BaseURL = "https://api.yookassa.ru/v3/payments"
+	APIURL  = "https://api.yookassa.ru/v3"
+)
+
+// SBP is the payment method of the Faster Payments System. Its payments
+// are confirmed with a QR code, and Request returns the SBP payload.
+const SBP = "sbp"
 
 type (
 	// Checkout implements checkout.Checkout.
 	Checkout struct {
 		ShopID string
 		APIKey string
+		Logger checkout.Logger
+
+		// Client and APIURL default to http.DefaultClient and APIURL.
+		Client *http.Client
+		APIURL string
+
+		// Retry is the policy of retrying API calls, none by default.
+		Retry checkout.RetryPolicy
 	}
 
 	Amount struct {
@@ -27,14 +47,20 @@ type (
 
 	Confirmation struct {
 		Type      string `json:"type"`
-		ReturnURL string `json:"return_url"`
+		ReturnURL string `json:"return_url,omitempty"`
+	}
+
+	PaymentMethodData struct {
+		Type string `json:"type"`
 	}
 
 	Request struct {
-		Description  string       `json:"description"`
-		Amount       Amount       `json:"amount"`
-		Confirmation Confirmation `json:"confirmation"`
-		Capture      bool         `json:"capture"`
+		Description       string             `json:"description"`
+		Amount            Amount             `json:"amount"`
+		PaymentMethodData *PaymentMethodData `json:"payment_method_data,omitempty"`
+		Confirmation      Confirmation       `json:"confirmation"`
+		Capture           bool               `json:"capture"`
+		Metadata          checkout.Metadata  `json:"metadata,omitempty"`
 	}
 
 	Payment struct {
@@ -49,6 +75,12 @@ type (
 		Expires     time.Time         `json:"expires_at"`
 		Description string            `json:"description"`
 		Metadata    checkout.Metadata `json:"metadata"`
+		Refunded    Amount            `json:"refunded_amount"`
+
+		Cancellation struct {
+			Party  string `json:"party"`
+			Reason string `json:"reason"`
+		} `json:"cancellation_details"`
 
 		Recipient struct {
 			AccountID string `json:"account_id"`
@@ -56,7 +88,10 @@ type (
 		} `json:"recipient"`
 
 		Confirmation struct {
-			URL string `json:"confirmation_url"`
+			Type string `json:"type"`
+			URL  string `json:"confirmation_url,omitempty"`
+			// Data is the SBP payload of QR confirmations.
+			Data string `json:"confirmation_data,omitempty"`
 		} `json:"confirmation"`
 	}
 
@@ -67,6 +102,11 @@ type (
 	}
 )
 
+// Money returns the amount as checkout.Money.
+func (a Amount) Money() (checkout.Money, error) {
+	return checkout.ParseMoney(a.Value, a.Currency)
+}
+
 // From returns the original payment structure.
 func From(payment checkout.Payment) Payment {
 	p, _ := payment.V.(Payment)
@@ -81,73 +121,355 @@ func idempotenceKey() (string, error) {
 	return key.String(), nil
 }
 
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "yookassa",
+		Metadata:   true,
+		Hold:       true,
+		Profit:     true,
+		Refunds:    true,
+		Fields:     []string{"Comment", "SuccessURL", "PaymentMethod"},
+		Currencies: []string{checkout.RUB},
+		MaxComment: 128,
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
+}
+
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
-	data, err := json.Marshal(Request{
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout. The payment method,
+// if set, is a YooKassa payment method type, e.g. "bank_card" or SBP.
+// SBP payments return the SBP payload instead of the confirmation URL.
+func (c Checkout) RequestContext(ctx context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
+	req := Request{
 		Description:  payment.Comment,
-		Amount:       Amount{Value: payment.Amount, Currency: payment.Currency},
+		Amount:       Amount{Value: payment.Amount.StringFixed(2), Currency: payment.Amount.Currency},
 		Confirmation: Confirmation{Type: "redirect", ReturnURL: payment.SuccessURL},
-		Capture:      true,
-	})
-	if err != nil {
+		Capture:      !payment.Hold,
+		Metadata:     payment.Metadata,
+	}
+	if payment.PaymentMethod != "" {
+		req.PaymentMethodData = &PaymentMethodData{Type: payment.PaymentMethod}
+	}
+	if payment.PaymentMethod == SBP {
+		req.Confirmation = Confirmation{Type: "qr", ReturnURL: payment.SuccessURL}
+	}
+
+	var result Payment
+	if err := c.do(ctx, http.MethodPost, "payments", req, &result, payment.ID); err != nil {
 		return "", err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, BaseURL, bytes.NewReader(data))
+	if result.Confirmation.Type == "qr" {
+		return result.Confirmation.Data, nil
+	}
+	return result.Confirmation.URL, nil
+}
+
+// Payment implements checkout.Fetcher.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	var result Payment
+	if err := c.do(ctx, http.MethodGet, "payments/"+url.PathEscape(id), nil, &result, ""); err != nil {
+		return checkout.Payment{}, err
+	}
+	return normalize(result)
+}
+
+// Payments implements checkout.Lister.
+func (c Checkout) Payments(ctx context.Context, from, to time.Time) ([]checkout.Payment, error) {
+	params := url.Values{}
+	params.Set("created_at.gte", from.UTC().Format(time.RFC3339Nano))
+	params.Set("created_at.lt", to.UTC().Format(time.RFC3339Nano))
+	params.Set("limit", "100")
+
+	var payments []checkout.Payment
+	for {
+		var result struct {
+			Items      []Payment `json:"items"`
+			NextCursor string    `json:"next_cursor"`
+		}
+		if err := c.do(ctx, http.MethodGet, "payments?"+params.Encode(), nil, &result, ""); err != nil {
+			return nil, err
+		}
+
+		for _, p := range result.Items {
+			payment, err := normalize(p)
+			if err != nil {
+				return nil, err
+			}
+			payments = append(payments, payment)
+		}
+
+		if result.NextCursor == "" {
+			return payments, nil
+		}
+		params.Set("cursor", result.NextCursor)
+	}
+}
+
+// Capture implements checkout.Capturer.
+func (c Checkout) Capture(ctx context.Context, id string, amount checkout.Money) (checkout.Payment, error) {
+	var req struct {
+		Amount *Amount `json:"amount,omitempty"`
+	}
+	if !amount.IsZero() {
+		req.Amount = &Amount{Value: amount.StringFixed(2), Currency: amount.Currency}
+	}
+	return c.transition(ctx, id, "capture", req)
+}
+
+// Void implements checkout.Capturer.
+func (c Checkout) Void(ctx context.Context, id string) (checkout.Payment, error) {
+	return c.transition(ctx, id, "cancel", struct{}{})
+}
+
+func (c Checkout) transition(ctx context.Context, id, action string, req any) (checkout.Payment, error) {
+	ik, err := idempotenceKey()
 	if err != nil {
-		return "", err
+		return checkout.Payment{}, err
+	}
+
+	var result Payment
+	if err := c.do(ctx, http.MethodPost, "payments/"+url.PathEscape(id)+"/"+action, req, &result, ik); err != nil {
+		return checkout.Payment{}, err
+	}
+	return normalize(result)
+}
+
+// do calls the API endpoint, encoding r as a request body unless it's nil,
+// and decoding the response into v. Temporary failures are retried
+// according to the retry policy with the same idempotence key.
+func (c Checkout) do(ctx context.Context, method, end string, r, v any, ik string) error {
+	var data []byte
+	if r != nil {
+		var err error
+		if data, err = json.Marshal(r); err != nil {
+			return err
+		}
+	}
+
+	return c.Retry.Do(ctx, func() error {
+		return c.attempt(ctx, method, end, data, v, ik)
+	})
+}
+
+func (c Checkout) attempt(ctx context.Context, method, end string, data []byte, v any, ik string) error {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	base := c.APIURL
+	if base == "" {
+		base = APIURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, base+"/"+end, body)
+	if err != nil {
+		return err
 	}
 
 	req.SetBasicAuth(c.ShopID, c.APIKey)
-	req.Header.Set("Idempotence-Key", payment.ID)
-	req.Header.Set("Content-Type", "application/json")
+	if ik != "" {
+		req.Header.Set("Idempotence-Key", ik)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 
-	var result Payment
-	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+			Parameter   string `json:"parameter"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+
+		msg := e.Description
+		if e.Parameter != "" {
+			msg += " (" + e.Parameter + ")"
+		}
+
+		return &checkout.ProviderError{
+			Checkout:   "yookassa",
+			StatusCode: resp.StatusCode,
+			Code:       e.Code,
+			Message:    msg,
+			RetryAfter: checkout.RetryAfter(resp),
+		}
 	}
 
-	return result.Confirmation.URL, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
-var statuses = map[string]int{
-	"waiting_for_capture": checkout.StatusWaiting,
+var statuses = map[string]checkout.Status{
+	"pending":             checkout.StatusWaiting,
+	"waiting_for_capture": checkout.StatusWaitingForCapture,
 	"succeeded":           checkout.StatusPaid,
 	"canceled":            checkout.StatusRejected,
 }
 
+// NormalStatus returns the normalized status of the payment.
+func (p Payment) NormalStatus() checkout.Status {
+	switch p.Status {
+	case "canceled":
+		if p.Cancellation.Party == "merchant" {
+			return checkout.StatusCanceled
+		}
+	case "succeeded":
+		if p.Refunded.Value == "" {
+			break
+		}
+		refunded, err1 := p.Refunded.Money()
+		amount, err2 := p.Amount.Money()
+		if err1 != nil || err2 != nil || !refunded.IsPositive() {
+			break
+		}
+		if cmp, _ := refunded.Cmp(amount); cmp < 0 {
+			return checkout.StatusPartiallyRefunded
+		}
+		return checkout.StatusRefunded
+	}
+	return statuses[p.Status]
+}
+
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
+
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var event Event
-		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-			log.Println("checkout/yookassa:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		payment, err := c.parse(r)
+		if err != nil {
+			checkout.WebhookError(w, r, c.Logger, "yookassa", err)
 			return
 		}
 
-		payment := checkout.Payment{
-			Checkout: "yookassa",
-			ID:       event.Object.ID,
-			Amount:   event.Object.Amount.Value,
-			Currency: event.Object.Amount.Currency,
-			Comment:  event.Object.Description,
-			Status:   statuses[event.Object.Status],
-			Profit:   event.Object.Income.Value,
-			PaidAt:   event.Object.Captured,
-			V:        event.Object,
-		}
-
-		if err := callback(payment); err != nil {
-			log.Println("checkout/yookassa:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "yookassa", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 	})
 }
+
+// networks are the addresses YooKassa sends notifications from.
+var networks = checkout.MustParseNetworks(
+	"185.71.76.0/27",
+	"185.71.77.0/27",
+	"77.75.153.0/25",
+	"77.75.156.11",
+	"77.75.156.35",
+	"77.75.154.128/25",
+	"2a02:5180::/32",
+)
+
+// Networks implements checkout.Networker.
+func (c Checkout) Networks() []netip.Prefix {
+	return networks
+}
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		return false
+	}
+	return event.Type == "notification" && event.Name != ""
+}
+
+// Parse implements checkout.Parser. Refund events carry the refund only,
+// so their payment has the ID of the refunded payment, StatusUnknown and
+// the Refund as V. The webhook looks up the payment's state instead.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	var event struct {
+		Name   string          `json:"event"`
+		Object json.RawMessage `json:"object"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if strings.HasPrefix(event.Name, "refund.") {
+		var refund Refund
+		if err := json.Unmarshal(event.Object, &refund); err != nil {
+			return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+		}
+		return checkout.Payment{Checkout: "yookassa", ID: refund.PaymentID, V: refund}, nil
+	}
+
+	var p Payment
+	if err := json.Unmarshal(event.Object, &p); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	payment, err := normalize(p)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	return payment, nil
+}
+
+// parse parses the webhook, looking up the refunded payment
+// of refund events to get its actual state.
+func (c Checkout) parse(r *http.Request) (checkout.Payment, error) {
+	payment, err := c.Parse(r)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+	if refund, ok := payment.V.(Refund); ok {
+		return c.Payment(r.Context(), refund.PaymentID)
+	}
+	return payment, nil
+}
+
+// normalize converts the original payment into checkout.Payment.
+func normalize(p Payment) (checkout.Payment, error) {
+	amount, err := p.Amount.Money()
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	profit, err := p.Income.Money()
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	return checkout.Payment{
+		Checkout: "yookassa",
+		ID:       p.ID,
+		Amount:   amount,
+		Comment:  p.Description,
+		Metadata: p.Metadata,
+		Status:   p.NormalStatus(),
+		Profit:   profit,
+		PaidAt:   p.Captured,
+		V:        p,
+	}, nil
+}
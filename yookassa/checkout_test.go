@@ -0,0 +1,241 @@
+package yookassa_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/yookassa"
+	"go.massbots.xyz/checkout/yookassa/yookassatest"
+)
+
+func TestPaymentRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	srv := yookassatest.NewServer("shop", "key")
+	defer srv.Close()
+
+	co := srv.Checkout()
+
+	var got []checkout.Payment
+	srv.Webhook = co.WebhookContext(func(_ context.Context, p checkout.Payment) error {
+		got = append(got, p)
+		return nil
+	})
+
+	// The only accepted currency may be omitted.
+	link, err := co.RequestContext(ctx, checkout.Payment{
+		ID:      "order-1",
+		Amount:  checkout.MustParseMoney("100.00", ""),
+		Comment: "Premium",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := srv.LastID()
+	if !strings.HasSuffix(link, "/checkout/"+id) {
+		t.Errorf("link = %q, want the confirmation URL of %s", link, id)
+	}
+
+	// A repeated request is made with the same idempotence key.
+	again, err := co.RequestContext(ctx, checkout.Payment{
+		ID:      "order-1",
+		Amount:  checkout.MustParseMoney("100.00", ""),
+		Comment: "Premium",
+	})
+	if err != nil || again != link || srv.LastID() != id {
+		t.Errorf("repeated request = %q, %v, want %q", again, err, link)
+	}
+
+	if err := srv.Pay(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("%d notifications, want 1", len(got))
+	}
+	if p := got[0]; p.ID != id || p.Status != checkout.StatusPaid ||
+		!p.Amount.Equal(checkout.MustParseMoney("100", checkout.RUB)) {
+		t.Errorf("notified of %+v", p)
+	}
+
+	p, err := co.Payment(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != checkout.StatusPaid || p.Comment != "Premium" {
+		t.Errorf("Payment = %+v", p)
+	}
+
+	if _, err := co.Payment(ctx, "missing"); !errors.Is(err, checkout.ErrPaymentNotFound) {
+		t.Errorf("Payment of a missing ID = %v, want ErrPaymentNotFound", err)
+	}
+
+	list, err := co.Payments(ctx, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil || len(list) != 1 || list[0].ID != id {
+		t.Errorf("Payments = %v, %v", list, err)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+
+	srv := yookassatest.NewServer("shop", "key")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	if _, err := co.Request(checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100", checkout.RUB)}); err != nil {
+		t.Fatal(err)
+	}
+	id := srv.LastID()
+
+	thirty := checkout.MustParseMoney("30", checkout.RUB)
+	if _, err := co.Refund(ctx, id, thirty, "partial"); !errors.Is(err, checkout.ErrNotRefundable) {
+		t.Errorf("Refund of a pending payment = %v, want ErrNotRefundable", err)
+	}
+
+	if err := srv.Pay(id); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := co.Refund(ctx, id, thirty, "partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != checkout.StatusRefunded || !first.Amount.Equal(thirty) || first.Reason != "partial" {
+		t.Errorf("Refund = %+v", first)
+	}
+
+	// A repeated refund isn't made twice.
+	repeated, err := co.Refund(ctx, id, thirty, "partial")
+	if err != nil || repeated.ID != first.ID {
+		t.Errorf("repeated Refund = %+v, %v, want refund %s", repeated, err, first.ID)
+	}
+
+	// Another key makes an equal refund on purpose.
+	second, err := co.Refund(checkout.WithRefundKey(ctx, "second"), id, thirty, "partial")
+	if err != nil || second.ID == first.ID {
+		t.Errorf("Refund with another key = %+v, %v", second, err)
+	}
+
+	p, err := co.Payment(ctx, id)
+	if err != nil || p.Status != checkout.StatusPartiallyRefunded {
+		t.Errorf("Payment after partial refunds = %s, %v", p.Status, err)
+	}
+
+	if _, err := co.Refund(ctx, id, checkout.MustParseMoney("50", checkout.RUB), ""); !errors.Is(err, checkout.ErrRefundExceeded) {
+		t.Errorf("Refund over the rest = %v, want ErrRefundExceeded", err)
+	}
+
+	rest, err := co.Refund(ctx, id, checkout.Money{}, "")
+	if err != nil || !rest.Amount.Equal(checkout.MustParseMoney("40", checkout.RUB)) {
+		t.Errorf("Refund of the rest = %+v, %v", rest, err)
+	}
+
+	byID, err := co.RefundByID(ctx, id, rest.ID)
+	if err != nil || byID.ID != rest.ID || byID.PaymentID != id {
+		t.Errorf("RefundByID = %+v, %v", byID, err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ctx := context.Background()
+
+	srv := yookassatest.NewServer("shop", "key")
+	defer srv.Close()
+
+	co := srv.Checkout()
+
+	request := func() string {
+		_, err := co.Request(checkout.Payment{
+			ID:     time.Now().String(),
+			Amount: checkout.MustParseMoney("100", checkout.RUB),
+			Hold:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := srv.LastID()
+		if err := srv.Pay(id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	id := request()
+	p, err := co.Payment(ctx, id)
+	if err != nil || p.Status != checkout.StatusWaitingForCapture {
+		t.Fatalf("held payment = %s, %v", p.Status, err)
+	}
+
+	p, err = co.Capture(ctx, id, checkout.MustParseMoney("80", checkout.RUB))
+	if err != nil || p.Status != checkout.StatusPaid || !p.Amount.Equal(checkout.MustParseMoney("80", checkout.RUB)) {
+		t.Errorf("Capture = %+v, %v", p, err)
+	}
+
+	id = request()
+	p, err = co.Void(ctx, id)
+	if err != nil || p.Status != checkout.StatusCanceled {
+		t.Errorf("Void = %s, %v", p.Status, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := yookassatest.NewServer("shop", "key")
+	defer srv.Close()
+
+	co := srv.Checkout()
+	co.Retry = checkout.RetryPolicy{Attempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	srv.Fail(yookassatest.Error{StatusCode: http.StatusInternalServerError, Code: "internal_server_error"})
+	srv.Fail(yookassatest.Error{StatusCode: http.StatusTooManyRequests, Code: "too_many_requests"})
+
+	payment := checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100", checkout.RUB)}
+	if _, err := co.Request(payment); err != nil {
+		t.Fatalf("Request after temporary failures: %v", err)
+	}
+
+	srv.Fail(yookassatest.Error{StatusCode: http.StatusBadRequest, Code: "invalid_request"})
+	srv.Fail(yookassatest.Error{StatusCode: http.StatusInternalServerError, Code: "internal_server_error"})
+
+	payment.ID = "2"
+	_, err := co.Request(payment)
+	var perr *checkout.ProviderError
+	if !errors.As(err, &perr) || perr.Code != "invalid_request" {
+		t.Errorf("Request = %v, want the invalid_request error unretried", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	co := yookassa.Checkout{ShopID: "shop", APIKey: "key"}
+
+	tests := []struct {
+		payment checkout.Payment
+		field   string
+	}{
+		{checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100", checkout.RUB)}, ""},
+		{checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100", "")}, ""},
+		{checkout.Payment{Amount: checkout.MustParseMoney("100", checkout.RUB)}, "ID"},
+		{checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100", checkout.USD)}, "Amount"},
+		{checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("100.001", checkout.RUB)}, "Amount"},
+		{checkout.Payment{ID: "1", Amount: checkout.MustParseMoney("-1", checkout.RUB)}, "Amount"},
+	}
+
+	for _, tt := range tests {
+		err := co.Validate(tt.payment)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("Validate(%s) = %v", tt.payment.Amount, err)
+			}
+			continue
+		}
+
+		var verr *checkout.ValidationError
+		if !errors.As(err, &verr) || verr.Field != tt.field {
+			t.Errorf("Validate(%+v) = %v, want an invalid %s", tt.payment, err, tt.field)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package yookassa
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("yookassa", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: yookassa://shop:key@?api_url=...&retry=3
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		ShopID: cfg.User,
+		APIKey: cfg.Password,
+		APIURL: cfg.Get("api_url"),
+	}
+
+	retry, err := cfg.Int("retry")
+	if err != nil {
+		return nil, err
+	}
+	c.Retry.Attempts = retry
+
+	if err := cfg.Require("shop", c.ShopID, "key", c.APIKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,99 @@
+package yookassa
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+type (
+	RefundRequest struct {
+		PaymentID   string `json:"payment_id"`
+		Amount      Amount `json:"amount"`
+		Description string `json:"description,omitempty"`
+	}
+
+	Refund struct {
+		ID          string    `json:"id"`
+		PaymentID   string    `json:"payment_id"`
+		Status      string    `json:"status"`
+		Amount      Amount    `json:"amount"`
+		Description string    `json:"description"`
+		Created     time.Time `json:"created_at"`
+	}
+)
+
+var refundStatuses = map[string]checkout.Status{
+	"pending":   checkout.StatusWaiting,
+	"succeeded": checkout.StatusRefunded,
+	"canceled":  checkout.StatusRejected,
+}
+
+// Refund implements checkout.Refunder. The refund is made with the
+// idempotence key of checkout.RefundKey.
+func (c Checkout) Refund(ctx context.Context, paymentID string, amount checkout.Money, reason string) (checkout.Refund, error) {
+	payment, err := c.Payment(ctx, paymentID)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if !checkout.Refundable(payment.Status) {
+		return checkout.Refund{}, checkout.ErrNotRefundable
+	}
+
+	refunded, err := From(payment).Refunded.Money()
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+	if refunded.Currency == "" {
+		refunded.Currency = payment.Amount.Currency
+	}
+
+	ik := checkout.RefundKey(ctx, paymentID, amount, reason)
+	amount, err = checkout.RefundAmount(payment.Amount, refunded, amount)
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	req := RefundRequest{
+		PaymentID:   paymentID,
+		Amount:      Amount{Value: amount.StringFixed(2), Currency: amount.Currency},
+		Description: reason,
+	}
+
+	var result Refund
+	if err := c.do(ctx, http.MethodPost, "refunds", req, &result, ik); err != nil {
+		return checkout.Refund{}, err
+	}
+
+	return result.refund()
+}
+
+// RefundByID implements checkout.Refunder.
+func (c Checkout) RefundByID(ctx context.Context, _, refundID string) (checkout.Refund, error) {
+	var result Refund
+	if err := c.do(ctx, http.MethodGet, "refunds/"+url.PathEscape(refundID), nil, &result, ""); err != nil {
+		return checkout.Refund{}, err
+	}
+	return result.refund()
+}
+
+func (r Refund) refund() (checkout.Refund, error) {
+	amount, err := r.Amount.Money()
+	if err != nil {
+		return checkout.Refund{}, err
+	}
+
+	return checkout.Refund{
+		ID:        r.ID,
+		PaymentID: r.PaymentID,
+		Checkout:  "yookassa",
+		Amount:    amount,
+		Reason:    r.Description,
+		CreatedAt: r.Created,
+		Status:    refundStatuses[r.Status],
+		V:         r,
+	}, nil
+}
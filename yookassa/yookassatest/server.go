@@ -0,0 +1,573 @@
+// Package yookassatest provides a fake YooKassa API for tests.
+//
+// The server keeps payments and refunds in memory, honours idempotence
+// keys and sends notifications to the configured webhook handler:
+//
+//	srv := yookassatest.NewServer("shop", "key")
+//	defer srv.Close()
+//
+//	co := srv.Checkout()
+//	srv.Webhook = co.Webhook(callback)
+//
+//	link, _ := co.Request(payment)
+//	srv.Pay(srv.LastID()) // callback is called with the paid payment
+package yookassatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.massbots.xyz/checkout"
+	"go.massbots.xyz/checkout/yookassa"
+)
+
+// Server is a fake YooKassa API.
+type Server struct {
+	*httptest.Server
+
+	ShopID string
+	APIKey string
+
+	// Webhook receives notifications on every payment or refund
+	// change, if it's set.
+	Webhook http.Handler
+
+	mu         sync.Mutex
+	payments   map[string]*payment
+	refunds    map[string]yookassa.Refund
+	keys       map[string]response
+	failures   []Error
+	deliveries []Delivery
+	last       string
+}
+
+type (
+	// Error is an error response of the API.
+	Error struct {
+		StatusCode  int    `json:"-"`
+		Type        string `json:"type"`
+		Code        string `json:"code"`
+		Description string `json:"description"`
+		Parameter   string `json:"parameter,omitempty"`
+
+		// RetryAfter is sent as the Retry-After header, unless zero.
+		RetryAfter time.Duration `json:"-"`
+	}
+
+	// Delivery is a notification sent to the webhook.
+	Delivery struct {
+		Event      string
+		StatusCode int
+	}
+
+	payment struct {
+		yookassa.Payment
+		capture bool
+	}
+
+	response struct {
+		status  int
+		body    []byte
+		request []byte
+	}
+)
+
+// NewServer starts a fake API accepting the given credentials.
+// The caller should call Close when finished.
+func NewServer(shopID, apiKey string) *Server {
+	s := &Server{
+		ShopID:   shopID,
+		APIKey:   apiKey,
+		payments: make(map[string]*payment),
+		refunds:  make(map[string]yookassa.Refund),
+		keys:     make(map[string]response),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Checkout returns a checkout pointed at the server.
+func (s *Server) Checkout() yookassa.Checkout {
+	return yookassa.Checkout{
+		ShopID: s.ShopID,
+		APIKey: s.APIKey,
+		Client: s.Client(),
+		APIURL: s.URL,
+	}
+}
+
+// Payment returns the payment by its ID.
+func (s *Server) Payment(id string) (yookassa.Payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[id]
+	if !ok {
+		return yookassa.Payment{}, false
+	}
+	return p.Payment, true
+}
+
+// LastID returns the ID of the last created payment.
+func (s *Server) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Deliveries returns the notifications sent to the webhook so far.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// Fail makes the next API call answer with the error.
+// Calls fail in the order errors were added.
+func (s *Server) Fail(e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, e)
+}
+
+// Pay simulates the customer paying the pending payment. It succeeds
+// right away or waits for capture, depending on the payment request.
+func (s *Server) Pay(id string) error {
+	s.mu.Lock()
+	p, ok := s.payments[id]
+	if !ok || p.Status != "pending" {
+		s.mu.Unlock()
+		return fmt.Errorf("yookassatest: payment %s can't be paid", id)
+	}
+
+	p.Paid = true
+	if p.capture {
+		s.succeed(p, p.Amount)
+	} else {
+		p.Status = "waiting_for_capture"
+	}
+	event := yookassa.Event{Type: "notification", Name: "payment." + p.Status, Object: p.Payment}
+	s.mu.Unlock()
+
+	s.notify(event.Name, event)
+	return nil
+}
+
+// Expire simulates the payment being canceled by YooKassa,
+// e.g. when the customer hasn't paid in time.
+func (s *Server) Expire(id string) error {
+	s.mu.Lock()
+	p, ok := s.payments[id]
+	if !ok || (p.Status != "pending" && p.Status != "waiting_for_capture") {
+		s.mu.Unlock()
+		return fmt.Errorf("yookassatest: payment %s can't be canceled", id)
+	}
+
+	s.cancel(p, "yoo_money", "expired_on_confirmation")
+	event := yookassa.Event{Type: "notification", Name: "payment.canceled", Object: p.Payment}
+	s.mu.Unlock()
+
+	s.notify(event.Name, event)
+	return nil
+}
+
+// Notify sends the event to the webhook and returns its status code.
+func (s *Server) Notify(event yookassa.Event) int {
+	return s.notify(event.Name, event)
+}
+
+func (s *Server) notify(name string, event any) int {
+	if s.Webhook == nil {
+		return 0
+	}
+
+	data, _ := json.Marshal(event)
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	s.Webhook.ServeHTTP(w, r)
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, Delivery{Event: name, StatusCode: w.Code})
+	s.mu.Unlock()
+
+	return w.Code
+}
+
+func (s *Server) succeed(p *payment, amount yookassa.Amount) {
+	p.Status = "succeeded"
+	p.Amount = amount
+	p.Income = amount
+	p.Captured = time.Now()
+}
+
+func (s *Server) cancel(p *payment, party, reason string) {
+	p.Status = "canceled"
+	p.Paid = false
+	p.Cancellation.Party = party
+	p.Cancellation.Reason = reason
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+
+	status, v, events := s.handle(r, body.Bytes())
+
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	if e, ok := v.(Error); ok && e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(e.RetryAfter.Seconds())))
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+
+	for _, e := range events {
+		s.notify(e.Name, e)
+	}
+}
+
+// event is a notification sent once the response is written.
+type event struct {
+	Type   string `json:"type"`
+	Name   string `json:"event"`
+	Object any    `json:"object"`
+}
+
+func (s *Server) handle(r *http.Request, body []byte) (int, any, []event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if shop, key, ok := r.BasicAuth(); !ok || shop != s.ShopID || key != s.APIKey {
+		return s.errorResponse(Error{
+			StatusCode:  http.StatusUnauthorized,
+			Code:        "invalid_credentials",
+			Description: "Authentication by given credentials failed",
+		})
+	}
+
+	if len(s.failures) > 0 {
+		e := s.failures[0]
+		s.failures = s.failures[1:]
+		return s.errorResponse(e)
+	}
+
+	ik := r.Header.Get("Idempotence-Key")
+	if r.Method == http.MethodPost {
+		if ik == "" {
+			return s.errorResponse(Error{
+				StatusCode:  http.StatusBadRequest,
+				Code:        "invalid_request",
+				Description: "Idempotence key is missing",
+				Parameter:   "Idempotence-Key",
+			})
+		}
+
+		key := r.URL.Path + " " + ik
+		if resp, ok := s.keys[key]; ok {
+			if !bytes.Equal(resp.request, body) {
+				return s.errorResponse(Error{
+					StatusCode:  http.StatusBadRequest,
+					Code:        "invalid_request",
+					Description: "Idempotence key duplicated with another request",
+					Parameter:   "Idempotence-Key",
+				})
+			}
+			return resp.status, json.RawMessage(resp.body), nil
+		}
+
+		status, v, events := s.route(r, body)
+		if status < http.StatusInternalServerError {
+			data, _ := json.Marshal(v)
+			s.keys[key] = response{status: status, body: data, request: body}
+		}
+		return status, v, events
+	}
+
+	return s.route(r, body)
+}
+
+func (s *Server) route(r *http.Request, body []byte) (int, any, []event) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "payments":
+		return s.createPayment(body)
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "payments":
+		return s.listPayments(r.URL.Query())
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "payments":
+		p, ok := s.payments[parts[1]]
+		if !ok {
+			return s.notFound()
+		}
+		return http.StatusOK, p.Payment, nil
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "payments" && parts[2] == "capture":
+		return s.capture(parts[1], body)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "payments" && parts[2] == "cancel":
+		return s.cancelPayment(parts[1])
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "refunds":
+		return s.createRefund(body)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "refunds":
+		refund, ok := s.refunds[parts[1]]
+		if !ok {
+			return s.notFound()
+		}
+		return http.StatusOK, refund, nil
+	}
+
+	return s.notFound()
+}
+
+func (s *Server) createPayment(body []byte) (int, any, []event) {
+	var req yookassa.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid("", err.Error())
+	}
+	if status, v, ok := s.validAmount(req.Amount, "amount"); !ok {
+		return status, v, nil
+	}
+
+	p := &payment{capture: req.Capture}
+	p.ID = uuid.NewString()
+	p.Status = "pending"
+	p.Test = true
+	p.Amount = req.Amount
+	p.Created = time.Now()
+	p.Expires = p.Created.Add(time.Hour)
+	p.Description = req.Description
+	p.Metadata = req.Metadata
+	p.Recipient.AccountID = s.ShopID
+
+	switch req.Confirmation.Type {
+	case "redirect":
+		p.Confirmation.Type = "redirect"
+		p.Confirmation.URL = s.URL + "/checkout/" + p.ID
+	case "qr":
+		if req.PaymentMethodData == nil || req.PaymentMethodData.Type != yookassa.SBP {
+			return s.invalid("confirmation.type", "QR confirmation is supported for sbp payments only")
+		}
+		// A dynamic SBP payload, the amount in kopecks.
+		p.Confirmation.Type = "qr"
+		p.Confirmation.Data = fmt.Sprintf("https://qr.nspk.ru/%s?type=02&bank=100000000000&sum=%d&cur=%s",
+			strings.ToUpper(strings.ReplaceAll(p.ID, "-", "")), money(p.Amount).Minor(), p.Amount.Currency)
+	default:
+		return s.invalid("confirmation.type", "Invalid confirmation type")
+	}
+
+	s.payments[p.ID] = p
+	s.last = p.ID
+	return http.StatusOK, p.Payment, nil
+}
+
+// listPayments returns the payments, newest first, filtered by the creation
+// time. The cursor is the offset of the next page.
+func (s *Server) listPayments(q url.Values) (int, any, []event) {
+	var gte, lt time.Time
+	if v := q.Get("created_at.gte"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return s.invalid("created_at.gte", err.Error())
+		}
+		gte = t
+	}
+	if v := q.Get("created_at.lt"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return s.invalid("created_at.lt", err.Error())
+		}
+		lt = t
+	}
+
+	limit := 10
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return s.invalid("limit", "Invalid limit")
+		}
+		limit = n
+	}
+
+	offset := 0
+	if v := q.Get("cursor"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return s.invalid("cursor", "Invalid cursor")
+		}
+		offset = n
+	}
+
+	var items []yookassa.Payment
+	for _, p := range s.payments {
+		if !gte.IsZero() && p.Created.Before(gte) {
+			continue
+		}
+		if !lt.IsZero() && !p.Created.Before(lt) {
+			continue
+		}
+		items = append(items, p.Payment)
+	}
+	sort.Slice(items, func(i, k int) bool {
+		if items[i].Created.Equal(items[k].Created) {
+			return items[i].ID < items[k].ID
+		}
+		return items[i].Created.After(items[k].Created)
+	})
+
+	list := struct {
+		Type       string             `json:"type"`
+		Items      []yookassa.Payment `json:"items"`
+		NextCursor string             `json:"next_cursor,omitempty"`
+	}{Type: "list", Items: []yookassa.Payment{}}
+
+	if offset < len(items) {
+		end := offset + limit
+		if end < len(items) {
+			list.NextCursor = strconv.Itoa(end)
+		} else {
+			end = len(items)
+		}
+		list.Items = items[offset:end]
+	}
+
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) capture(id string, body []byte) (int, any, []event) {
+	p, ok := s.payments[id]
+	if !ok {
+		return s.notFound()
+	}
+	if p.Status != "waiting_for_capture" {
+		return s.invalid("", "Payment is in "+p.Status+" status")
+	}
+
+	var req struct {
+		Amount *yookassa.Amount `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid("", err.Error())
+	}
+
+	amount := p.Amount
+	if req.Amount != nil {
+		if status, v, ok := s.validAmount(*req.Amount, "amount"); !ok {
+			return status, v, nil
+		}
+		if cmp, err := money(*req.Amount).Cmp(money(p.Amount)); err != nil || cmp > 0 {
+			return s.invalid("amount", "Capture amount exceeds the payment amount")
+		}
+		amount = *req.Amount
+	}
+
+	s.succeed(p, amount)
+	return http.StatusOK, p.Payment, []event{{Type: "notification", Name: "payment.succeeded", Object: p.Payment}}
+}
+
+func (s *Server) cancelPayment(id string) (int, any, []event) {
+	p, ok := s.payments[id]
+	if !ok {
+		return s.notFound()
+	}
+	if p.Status != "pending" && p.Status != "waiting_for_capture" {
+		return s.invalid("", "Payment is in "+p.Status+" status")
+	}
+
+	s.cancel(p, "merchant", "canceled_by_merchant")
+	return http.StatusOK, p.Payment, []event{{Type: "notification", Name: "payment.canceled", Object: p.Payment}}
+}
+
+func (s *Server) createRefund(body []byte) (int, any, []event) {
+	var req yookassa.RefundRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.invalid("", err.Error())
+	}
+
+	p, ok := s.payments[req.PaymentID]
+	if !ok {
+		return s.invalid("payment_id", "Payment doesn't exist")
+	}
+	if p.Status != "succeeded" {
+		return s.invalid("payment_id", "Payment is in "+p.Status+" status")
+	}
+	if status, v, ok := s.validAmount(req.Amount, "amount"); !ok {
+		return status, v, nil
+	}
+
+	refunded := money(p.Refunded)
+	if refunded.Currency == "" {
+		refunded.Currency = p.Amount.Currency
+	}
+	total, err := refunded.Add(money(req.Amount))
+	if err != nil {
+		return s.invalid("amount.currency", err.Error())
+	}
+	if cmp, _ := total.Cmp(money(p.Amount)); cmp > 0 {
+		return s.invalid("amount", "Refund amount exceeds the payment amount")
+	}
+
+	refund := yookassa.Refund{
+		ID:          uuid.NewString(),
+		PaymentID:   p.ID,
+		Status:      "succeeded",
+		Amount:      req.Amount,
+		Description: req.Description,
+		Created:     time.Now(),
+	}
+	s.refunds[refund.ID] = refund
+	p.Refunded = yookassa.Amount{Value: total.StringFixed(2), Currency: total.Currency}
+
+	return http.StatusOK, refund, []event{{Type: "notification", Name: "refund.succeeded", Object: refund}}
+}
+
+func (s *Server) validAmount(a yookassa.Amount, param string) (int, any, bool) {
+	m, err := a.Money()
+	if err != nil || !m.IsPositive() {
+		status, v, _ := s.invalid(param+".value", "Invalid amount value")
+		return status, v, false
+	}
+	if a.Currency == "" {
+		status, v, _ := s.invalid(param+".currency", "Currency is missing")
+		return status, v, false
+	}
+	return 0, nil, true
+}
+
+func (s *Server) invalid(param, description string) (int, any, []event) {
+	return s.errorResponse(Error{
+		StatusCode:  http.StatusBadRequest,
+		Code:        "invalid_request",
+		Description: description,
+		Parameter:   param,
+	})
+}
+
+func (s *Server) notFound() (int, any, []event) {
+	return s.errorResponse(Error{
+		StatusCode:  http.StatusNotFound,
+		Code:        "not_found",
+		Description: "Object not found",
+	})
+}
+
+func (s *Server) errorResponse(e Error) (int, any, []event) {
+	if e.Type == "" {
+		e.Type = "error"
+	}
+	return e.StatusCode, e, nil
+}
+
+func money(a yookassa.Amount) checkout.Money {
+	m, _ := a.Money()
+	return m
+}
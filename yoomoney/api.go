@@ -0,0 +1,181 @@
+package yoomoney
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.massbots.xyz/checkout"
+)
+
+const APIURL = "https://yoomoney.ru/api/"
+
+type (
+	// Operation is a wallet operation returned by the API.
+	Operation struct {
+		ID        string      `json:"operation_id"`
+		Status    string      `json:"status"`
+		Datetime  time.Time   `json:"datetime"`
+		Title     string      `json:"title"`
+		Direction string      `json:"direction"`
+		Amount    json.Number `json:"amount"`
+		// Fee is the commission held from the payment, returned
+		// with details.
+		Fee   json.Number `json:"fee,omitempty"`
+		Label string      `json:"label"`
+		Type  string      `json:"type"`
+	}
+)
+
+var operationStatuses = map[string]checkout.Status{
+	"success":     checkout.StatusPaid,
+	"in_progress": checkout.StatusWaiting,
+	"refused":     checkout.StatusRejected,
+}
+
+// Payment implements checkout.Fetcher. Requires Token with the
+// operation-history scope. Amount is charged from the payer, as
+// withdraw_amount of webhooks, and Profit is credited to the wallet.
+func (c Checkout) Payment(ctx context.Context, id string) (checkout.Payment, error) {
+	params := url.Values{}
+	params.Set("type", "deposition")
+	params.Set("details", "true")
+	params.Set("label", id)
+
+	var result struct {
+		Operations []Operation `json:"operations"`
+	}
+	if err := c.api(ctx, "operation-history", params, &result); err != nil {
+		return checkout.Payment{}, err
+	}
+	if len(result.Operations) == 0 {
+		return checkout.Payment{}, checkout.ErrPaymentNotFound
+	}
+
+	return result.Operations[0].payment()
+}
+
+// Payments implements checkout.Lister, listing incoming operations made
+// within the period. Operations without a label are skipped.
+func (c Checkout) Payments(ctx context.Context, from, to time.Time) ([]checkout.Payment, error) {
+	params := url.Values{}
+	params.Set("type", "deposition")
+	params.Set("details", "true")
+	params.Set("from", from.Format(time.RFC3339))
+	params.Set("till", to.Format(time.RFC3339))
+	params.Set("records", "100")
+
+	var payments []checkout.Payment
+	for {
+		var result struct {
+			NextRecord string      `json:"next_record"`
+			Operations []Operation `json:"operations"`
+		}
+		if err := c.api(ctx, "operation-history", params, &result); err != nil {
+			return nil, err
+		}
+
+		for _, o := range result.Operations {
+			if o.Label == "" {
+				continue
+			}
+			payment, err := o.payment()
+			if err != nil {
+				return nil, err
+			}
+			payments = append(payments, payment)
+		}
+
+		if result.NextRecord == "" {
+			return payments, nil
+		}
+		params.Set("start_record", result.NextRecord)
+	}
+}
+
+func (o Operation) payment() (checkout.Payment, error) {
+	profit, err := checkout.ParseMoney(o.Amount.String(), checkout.RUB)
+	if err != nil {
+		return checkout.Payment{}, err
+	}
+
+	amount := profit
+	if o.Fee != "" {
+		fee, err := checkout.ParseMoney(o.Fee.String(), checkout.RUB)
+		if err != nil {
+			return checkout.Payment{}, err
+		}
+		if amount, err = profit.Add(fee); err != nil {
+			return checkout.Payment{}, err
+		}
+	}
+
+	return checkout.Payment{
+		Checkout: "yoomoney",
+		ID:       o.Label,
+		Amount:   amount,
+		Comment:  o.Title,
+		Status:   operationStatuses[o.Status],
+		Profit:   profit,
+		PaidAt:   o.Datetime.UTC(),
+		V:        o,
+	}, nil
+}
+
+func (c Checkout) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+// api calls the wallet API method, decoding the response into v.
+func (c Checkout) api(ctx context.Context, method string, params url.Values, v any) error {
+	base := c.APIURL
+	if base == "" {
+		base = APIURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &checkout.ProviderError{
+			Checkout:   "yoomoney",
+			StatusCode: resp.StatusCode,
+			Code:       resp.Header.Get("WWW-Authenticate"),
+		}
+	}
+
+	var data json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+
+	var maybeError struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &maybeError) == nil && maybeError.Error != "" {
+		return &checkout.ProviderError{
+			Checkout:   "yoomoney",
+			StatusCode: resp.StatusCode,
+			Code:       maybeError.Error,
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -1,9 +1,10 @@
 package yoomoney
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -27,34 +28,70 @@ type (
 	Checkout struct {
 		Receiver  string
 		SecretKey string
+		Logger    checkout.Logger
+
+		// Token is an OAuth token of the receiver's wallet,
+		// needed to query the API.
+		Token string
+
+		// Client and APIURL default to http.DefaultClient and APIURL.
+		Client *http.Client
+		APIURL string
 	}
 )
 
 // WithCommission returns the given amount summed with the corresponding
 // to the payment type commission.
-func WithCommission(pt, amount string) string {
-	a, _ := decimal.NewFromString(amount)
+func WithCommission(pt string, amount checkout.Money) checkout.Money {
+	a := amount.Value
 
 	switch pt {
 	case PC:
 		const commission float64 = 0.005 / 1.005
-		return a.Add(a.Mul(decimal.NewFromFloat(commission))).StringFixed(2)
+		return checkout.NewMoney(a.Add(a.Mul(decimal.NewFromFloat(commission))).Round(2), amount.Currency)
 	case AC:
 		const commission float64 = 1 - 0.02
-		return a.Div(decimal.NewFromFloat(commission)).StringFixed(2)
+		return checkout.NewMoney(a.Div(decimal.NewFromFloat(commission)).Round(2), amount.Currency)
 	}
 
 	return amount
 }
 
+// Capabilities implements checkout.Validator.
+func (c Checkout) Capabilities() checkout.Capabilities {
+	return checkout.Capabilities{
+		Checkout:   "yoomoney",
+		Profit:     true,
+		Fields:     []string{"Comment", "SuccessURL", "Target", "Type"},
+		Currencies: []string{checkout.RUB},
+		MinAmount:  checkout.MustParseMoney("2", checkout.RUB),
+		MaxComment: 200,
+	}
+}
+
+// Validate implements checkout.Validator.
+func (c Checkout) Validate(p checkout.Payment) error {
+	return c.Capabilities().Validate(p)
+}
+
 // Request implements Checkout.Request. Does not support Metadata.
 func (c Checkout) Request(payment checkout.Payment) (string, error) {
+	return c.RequestContext(context.Background(), payment)
+}
+
+// RequestContext implements checkout.ContextCheckout.
+func (c Checkout) RequestContext(_ context.Context, payment checkout.Payment) (string, error) {
+	if err := c.Validate(payment); err != nil {
+		return "", err
+	}
+	payment = c.Capabilities().Normalize(payment)
+
 	params := url.Values{}
 	params.Set("receiver", c.Receiver)
 	params.Set("quickpay-form", "shop")
 	params.Set("paymentType", payment.Type)
 	params.Set("targets", payment.Target)
-	params.Set("sum", payment.Amount)
+	params.Set("sum", payment.Amount.StringFixed(2))
 	params.Set("comment", payment.Comment)
 	params.Set("label", payment.ID)
 	params.Set("successURL", payment.SuccessURL)
@@ -68,55 +105,93 @@ var (
 )
 
 func (c Checkout) Webhook(callback checkout.Callback) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			log.Println("checkout/yoomoney:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	return c.WebhookContext(checkout.WithoutContext(callback))
+}
 
-		paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("datetime"), timeLoc)
+// WebhookContext implements checkout.ContextCheckout.
+func (c Checkout) WebhookContext(callback checkout.ContextCallback) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payment, err := c.Parse(r)
 		if err != nil {
-			log.Println("checkout/yoomoney:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		payment := checkout.Payment{
-			Checkout: "yoomoney",
-			ID:       r.FormValue("label"),
-			Amount:   r.FormValue("withdraw_amount"),
-			Currency: r.FormValue("currency"),
-			Status:   checkout.StatusPaid,
-			Profit:   r.FormValue("amount"),
-			PaidAt:   paidAt.UTC(),
-		}
-
-		a := strings.Join([]string{
-			r.FormValue("notification_type"),
-			r.FormValue("operation_id"),
-			payment.Profit,
-			payment.Currency,
-			r.FormValue("datetime"),
-			r.FormValue("sender"),
-			r.FormValue("codepro"),
-			c.SecretKey,
-			r.FormValue("label"),
-		}, "&")
-
-		hash := sha1.Sum([]byte(a))
-		if r.FormValue("sha1_hash") != hex.EncodeToString(hash[:]) {
-			log.Println("checkout/yoomoney: bad signature")
-			w.WriteHeader(http.StatusForbidden)
+			checkout.WebhookError(w, r, c.Logger, "yoomoney", err)
 			return
 		}
 
-		if err := callback(payment); err != nil {
-			log.Println("checkout/yoomoney:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		if err := callback(r.Context(), payment); err != nil {
+			checkout.WebhookError(w, r, c.Logger, "yoomoney", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 	})
 }
+
+// Detect implements checkout.Detector.
+func (c Checkout) Detect(r *http.Request) bool {
+	return r.FormValue("sha1_hash") != "" && r.FormValue("notification_type") != ""
+}
+
+// Signature returns the expected sha1_hash of the notification form.
+func (c Checkout) Signature(form url.Values) string {
+	a := strings.Join([]string{
+		form.Get("notification_type"),
+		form.Get("operation_id"),
+		form.Get("amount"),
+		form.Get("currency"),
+		form.Get("datetime"),
+		form.Get("sender"),
+		form.Get("codepro"),
+		c.SecretKey,
+		form.Get("label"),
+	}, "&")
+
+	hash := sha1.Sum([]byte(a))
+	return hex.EncodeToString(hash[:])
+}
+
+// Parse implements checkout.Parser.
+func (c Checkout) Parse(r *http.Request) (checkout.Payment, error) {
+	if err := r.ParseForm(); err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	if r.FormValue("sha1_hash") != c.Signature(r.Form) {
+		return checkout.Payment{}, checkout.ErrBadSignature
+	}
+
+	paidAt, err := time.ParseInLocation(timeLayout, r.FormValue("datetime"), timeLoc)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	// The currency is sent as a numeric code, e.g. "643".
+	currency, err := checkout.ParseCurrency(r.FormValue("currency"))
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	amount, err := checkout.ParseMoney(r.FormValue("withdraw_amount"), currency.Code)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	profit, err := checkout.ParseMoney(r.FormValue("amount"), currency.Code)
+	if err != nil {
+		return checkout.Payment{}, fmt.Errorf("%w: %v", checkout.ErrMalformedPayload, err)
+	}
+
+	// Protected transfers wait for the code to be entered by the receiver.
+	status := checkout.StatusPaid
+	if r.FormValue("unaccepted") == "true" {
+		status = checkout.StatusWaiting
+	}
+
+	return checkout.Payment{
+		Checkout: "yoomoney",
+		ID:       r.FormValue("label"),
+		Amount:   amount,
+		Status:   status,
+		Profit:   profit,
+		PaidAt:   paidAt.UTC(),
+	}, nil
+}
@@ -0,0 +1,22 @@
+package yoomoney
+
+import "go.massbots.xyz/checkout"
+
+func init() {
+	checkout.Register("yoomoney", open)
+}
+
+// open builds a checkout from the configuration.
+// DSN: yoomoney://receiver:secret@?token=...&api_url=...
+func open(cfg checkout.Config) (checkout.Checkout, error) {
+	c := Checkout{
+		Receiver:  cfg.User,
+		SecretKey: cfg.Password,
+		Token:     cfg.Get("token"),
+		APIURL:    cfg.Get("api_url"),
+	}
+	if err := cfg.Require("receiver", c.Receiver, "secret", c.SecretKey); err != nil {
+		return nil, err
+	}
+	return c, nil
+}